@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Upper bound on RECENT_REQUESTS_SIZE to keep memory use predictable
+const maxRecentRequests = 10000
+
+// adminMiddleware guards admin endpoints with ADMIN_TOKEN, accepted as a
+// bearer token or in X-Admin-Token. Admin endpoints are disabled without it.
+// Every admin request, allowed or not, is recorded in the audit log.
+func adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return audited(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.AdminToken == "" {
+			writeLocalizedError(w, r, http.StatusForbidden, "admin_disabled")
+			return
+		}
+
+		token := r.Header.Get("X-Admin-Token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeLocalizedError(w, r, http.StatusUnauthorized, "admin_unauthorized")
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// auditLog records admin actions as JSON, apart from the access log
+var auditLog = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+// audited writes an audit entry with the client, endpoint and outcome of
+// each request once it has been handled
+func audited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := newStatusRecorder(w)
+		next(rec, r)
+
+		client := r.RemoteAddr
+		if ip, ok := remoteIP(r.RemoteAddr); ok {
+			client = ip.String()
+		}
+		outcome := "success"
+		switch {
+		case rec.status == http.StatusUnauthorized || rec.status == http.StatusForbidden:
+			outcome = "denied"
+		case rec.status >= http.StatusBadRequest:
+			outcome = "failure"
+		}
+
+		auditLog.Info("admin.action",
+			"client_ip", client,
+			"method", r.Method,
+			"endpoint", r.URL.Path,
+			"outcome", outcome,
+			"status", rec.status,
+			"request_id", w.Header().Get(cfg.RequestIDHeader),
+		)
+	}
+}
+
+// RecentRequest is one entry in the in-memory access log
+type RecentRequest struct {
+	Method   string   `json:"method"`
+	Path     string   `json:"path"`
+	Status   int      `json:"status"`
+	Duration string   `json:"duration"`
+	Time     JSONTime `json:"time"`
+
+	// Set when CHAOS_ENABLED, for /admin/replay
+	replay *replayRequest
+}
+
+// requestRing keeps the last N requests, overwriting the oldest
+type requestRing struct {
+	mu      sync.Mutex
+	entries []RecentRequest
+	next    int
+	full    bool
+}
+
+func newRequestRing(size int) *requestRing {
+	if size > maxRecentRequests {
+		size = maxRecentRequests
+	}
+	if size < 0 {
+		size = 0
+	}
+	return &requestRing{entries: make([]RecentRequest, size)}
+}
+
+var recentRequests = newRequestRing(0)
+
+func (rr *requestRing) Add(entry RecentRequest) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if len(rr.entries) == 0 {
+		return
+	}
+	rr.entries[rr.next] = entry
+	rr.next = (rr.next + 1) % len(rr.entries)
+	if rr.next == 0 {
+		rr.full = true
+	}
+}
+
+// Snapshot returns the buffered requests, newest first
+func (rr *requestRing) Snapshot() []RecentRequest {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	count := rr.next
+	if rr.full {
+		count = len(rr.entries)
+	}
+
+	out := make([]RecentRequest, 0, count)
+	for i := 1; i <= count; i++ {
+		idx := (rr.next - i + len(rr.entries)) % len(rr.entries)
+		out = append(out, rr.entries[idx])
+	}
+	return out
+}
+
+func (rr *requestRing) Capacity() int {
+	return len(rr.entries)
+}
+
+// recentRequestsMiddleware records every request into the ring buffer
+func recentRequestsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if recentRequests.Capacity() == 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isReplay(r) {
+			next(w, r)
+			return
+		}
+
+		start := clock.Now()
+		var finishReplay func() *replayRequest
+		if cfg.ChaosEnabled {
+			finishReplay = captureForReplay(r)
+		}
+		rec := newStatusRecorder(w)
+		next(rec, r)
+
+		entry := RecentRequest{
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Status:   rec.status,
+			Duration: clock.Since(start).String(),
+			Time:     responseTime(start),
+		}
+		if finishReplay != nil {
+			entry.replay = finishReplay()
+		}
+		recentRequests.Add(entry)
+	}
+}
+
+type RecentRequestsResponse struct {
+	Capacity  int             `json:"capacity"`
+	Count     int             `json:"count"`
+	Requests  []RecentRequest `json:"requests"`
+	Timestamp JSONTime        `json:"timestamp"`
+}
+
+func recentRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	requests := recentRequests.Snapshot()
+	writeJSON(w, http.StatusOK, RecentRequestsResponse{
+		Capacity:  recentRequests.Capacity(),
+		Count:     len(requests),
+		Requests:  requests,
+		Timestamp: nowFunc(),
+	})
+}
+
+// Made with Bob
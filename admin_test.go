@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// setAdmin enables the admin endpoints with token and silences the audit log
+// for the rest of the test
+func setAdmin(t *testing.T, token string) {
+	t.Helper()
+	cfg.AdminToken = token
+	saved := auditLog
+	auditLog = slog.New(slog.NewJSONHandler(io.Discard, nil))
+	t.Cleanup(func() { auditLog = saved })
+}
+
+// setRecentRequests replaces the recent requests buffer for the rest of the test
+func setRecentRequests(t *testing.T, size int) {
+	t.Helper()
+	saved := recentRequests
+	recentRequests = newRequestRing(size)
+	t.Cleanup(func() { recentRequests = saved })
+}
+
+func TestAdminRecentListsRequests(t *testing.T) {
+	setConfig(t, nil)
+	setAdmin(t, "secret")
+	setRecentRequests(t, 3)
+
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/one", okHandler)
+	router.Handle(http.MethodPost, "/two", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	router.Handle(http.MethodGet, "/admin/recent", adminMiddleware(recentRequestsHandler))
+	handler := recentRequestsMiddleware(router.ServeHTTP)
+
+	serve(handler, http.MethodGet, "/one", "")
+	serve(handler, http.MethodPost, "/two", "")
+	serve(handler, http.MethodGet, "/missing", "")
+
+	if rec := serve(handler, http.MethodGet, "/admin/recent", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, newRequestWithHeader(http.MethodGet, "/admin/recent", "Authorization", "Bearer secret"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp RecentRequestsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Newest first, with the oldest request pushed out of the three slots
+	want := []RecentRequest{
+		{Method: http.MethodGet, Path: "/admin/recent", Status: http.StatusUnauthorized},
+		{Method: http.MethodGet, Path: "/missing", Status: http.StatusNotFound},
+		{Method: http.MethodPost, Path: "/two", Status: http.StatusCreated},
+	}
+	if resp.Capacity != 3 || resp.Count != len(want) {
+		t.Fatalf("capacity %d, count %d: %+v", resp.Capacity, resp.Count, resp.Requests)
+	}
+	for i, w := range want {
+		got := resp.Requests[i]
+		if got.Method != w.Method || got.Path != w.Path || got.Status != w.Status {
+			t.Errorf("request %d = %s %s %d, want %s %s %d", i, got.Method, got.Path, got.Status, w.Method, w.Path, w.Status)
+		}
+	}
+}
+
+func TestAdminActionAudited(t *testing.T) {
+	setConfig(t, nil)
+	setAdmin(t, "secret")
+	logs := captureLogs(t)
+	audit := &logBuffer{}
+	auditLog = slog.New(slog.NewJSONHandler(audit, nil))
+
+	handler := adminMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	req := newRequestWithHeader(http.MethodPut, "/admin/flags/beta", "X-Admin-Token", "secret")
+	req.RemoteAddr = "198.51.100.9:4321"
+	handler(httptest.NewRecorder(), req)
+	req = httptest.NewRequest(http.MethodPut, "/admin/flags/beta", nil)
+	req.RemoteAddr = "203.0.113.5:1111"
+	handler(httptest.NewRecorder(), req)
+
+	type entry struct {
+		Time     string `json:"time"`
+		Msg      string `json:"msg"`
+		ClientIP string `json:"client_ip"`
+		Endpoint string `json:"endpoint"`
+		Outcome  string `json:"outcome"`
+		Status   int    `json:"status"`
+	}
+	var entries []entry
+	for _, line := range strings.Split(strings.TrimSpace(audit.String()), "\n") {
+		var e entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("audit line %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+
+	want := []entry{
+		{Msg: "admin.action", ClientIP: "198.51.100.9", Endpoint: "/admin/flags/beta", Outcome: "success", Status: http.StatusOK},
+		{Msg: "admin.action", ClientIP: "203.0.113.5", Endpoint: "/admin/flags/beta", Outcome: "denied", Status: http.StatusUnauthorized},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("audit entries = %+v, want %d", entries, len(want))
+	}
+	for i := range want {
+		if entries[i].Time == "" {
+			t.Errorf("entry %d has no timestamp", i)
+		}
+		entries[i].Time = ""
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+	if strings.Contains(logs.String(), "admin.action") {
+		t.Errorf("audit entry written to the regular log:\n%s", logs)
+	}
+}
+
+func TestRequestRingCapped(t *testing.T) {
+	if got := newRequestRing(maxRecentRequests + 1).Capacity(); got != maxRecentRequests {
+		t.Errorf("capacity = %d, want the %d cap", got, maxRecentRequests)
+	}
+	if got := newRequestRing(-1).Capacity(); got != 0 {
+		t.Errorf("negative size: capacity = %d, want 0", got)
+	}
+}
+
+// Made with Bob
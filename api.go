@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// apiVersions lists the versioned API groups, oldest first. v2 currently
+// serves the same routes as v1; breaking schema changes land in v2 only.
+var apiVersions = []struct {
+	prefix   string
+	register func(r RouteRegistrar)
+}{
+	{"/v1", registerAPIv1},
+	{"/v2", registerAPIv2},
+}
+
+func registerAPIv1(r RouteRegistrar) {
+	r.Handle(http.MethodGet, "/api/info", cacheable(jsonHandler(infoHandler)))
+	r.Handle(http.MethodGet, "/api/echo", dynamic(jsonHandler(echoHandler)))
+	r.Handle(http.MethodGet, "/api/echo/full", dynamic(jsonHandler(fullEchoHandler)))
+	r.Handle(http.MethodPost, "/api/echo/full", dynamic(jsonHandler(fullEchoHandler)))
+	r.Handle(http.MethodPost, "/api/echo/raw", dynamic(uncompressed(rawEchoHandler)), WithConcurrencyLimit(uploadSlots))
+	r.Handle(http.MethodPost, "/api/data", dynamic(jsonHandler(dataHandler)), WithRateLimit(cfg.WriteRateLimit))
+	r.Handle(http.MethodGet, "/api/data/{name}", dynamic(jsonHandler(getDataHandler)))
+	r.Handle(http.MethodPut, "/api/data/{name}", dynamic(jsonHandler(putDataHandler)), WithRateLimit(cfg.WriteRateLimit))
+	r.Handle(http.MethodPatch, "/api/data/{name}", dynamic(jsonHandler(patchDataHandler)), WithRateLimit(cfg.WriteRateLimit))
+	r.Handle(http.MethodDelete, "/api/data/{name}", dynamic(jsonHandler(deleteDataHandler)), WithRateLimit(cfg.WriteRateLimit))
+	if dataJobs != nil {
+		r.Handle(http.MethodGet, "/api/data/jobs/{id}", dynamic(jsonHandler(getJobHandler)))
+	}
+}
+
+func registerAPIv2(r RouteRegistrar) {
+	registerAPIv1(r)
+}
+
+// apiVersionPrefixes lists the version prefixes for the home page, e.g. "/v1, /v2"
+func apiVersionPrefixes() string {
+	prefixes := make([]string, len(apiVersions))
+	for i, v := range apiVersions {
+		prefixes[i] = v.prefix
+	}
+	return strings.Join(prefixes, ", ")
+}
+
+// Made with Bob
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// newVersionedRouter registers the API as main does: unversioned aliases of
+// the oldest version plus a group per version
+func newVersionedRouter(t *testing.T) *Router {
+	t.Helper()
+	router := newAPIRouter(t)
+	for _, v := range apiVersions {
+		router.Group(v.prefix, func(g *RouteGroup) { v.register(g) })
+	}
+	return router
+}
+
+func TestAPIVersionGroups(t *testing.T) {
+	setConfig(t, nil)
+	router := newVersionedRouter(t)
+
+	if rec := serve(router, http.MethodPost, "/v1/api/data", `{"name":"item","value":"v1"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("POST /v1/api/data: status = %d: %s", rec.Code, rec.Body)
+	}
+	for _, target := range []string{"/v1/api/data/item", "/v2/api/data/item", "/api/data/item"} {
+		rec := serve(router, http.MethodGet, target, "")
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: status = %d", target, rec.Code)
+			continue
+		}
+		if got := decodeData(t, rec.Body.Bytes()); got.Value != "v1" {
+			t.Errorf("GET %s: value = %q", target, got.Value)
+		}
+	}
+	if rec := serve(router, http.MethodGet, "/v3/api/info", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown version: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestHomeListsAPIVersions(t *testing.T) {
+	setConfig(t, nil)
+	rec := serve(http.HandlerFunc(homeHandler), http.MethodGet, "/", "")
+
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["versions"] != "/v1, /v2" {
+		t.Errorf("versions = %q, want /v1, /v2", resp["versions"])
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Paths that never require API_TOKEN so liveness and readiness probes keep working
+var alwaysAuthExempt = map[string]bool{
+	"/health":    true,
+	"/readiness": true,
+}
+
+// authMiddleware requires API_TOKEN as a bearer token on every request except
+// AUTH_EXEMPT_PATHS, the health probes and /admin/ (guarded by ADMIN_TOKEN).
+// It does nothing when API_TOKEN is unset.
+func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if cfg.APIToken == "" {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authExempt(r.URL.Path) {
+			next(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.APIToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeLocalizedError(w, r, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func authExempt(path string) bool {
+	return alwaysAuthExempt[path] || cfg.AuthExemptPaths[path] || strings.HasPrefix(path, "/admin/")
+}
+
+// Made with Bob
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthExemptPaths(t *testing.T) {
+	t.Setenv("AUTH_EXEMPT_PATHS", "/api/info")
+	setConfig(t, func(c *Config) { c.APIToken = "api-secret" })
+	handler := authMiddleware(okHandler)
+
+	tests := []struct {
+		path  string
+		token string
+		want  int
+	}{
+		{"/api/info", "", http.StatusOK},
+		{"/health", "", http.StatusOK},
+		{"/readiness", "", http.StatusOK},
+		{"/", "", http.StatusUnauthorized},
+		{"/api/data", "", http.StatusUnauthorized},
+		{"/api/data", "wrong", http.StatusUnauthorized},
+		{"/api/data", "api-secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s with token %q: status = %d, want %d", tt.path, tt.token, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestAuthRequiresBearerScheme(t *testing.T) {
+	setConfig(t, func(c *Config) { c.APIToken = "api-secret" })
+	handler := authMiddleware(okHandler)
+
+	for _, header := range []string{"api-secret", "Basic api-secret"} {
+		rec := httptest.NewRecorder()
+		handler(rec, newRequestWithHeader(http.MethodGet, "/api/data", "Authorization", header))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status = %d, want 401", header, rec.Code)
+		}
+	}
+}
+
+func TestCORSAllowsAuthorizationHeader(t *testing.T) {
+	setConfig(t, nil)
+	router := NewRouter()
+	rec := serve(corsMiddleware(router)(router.ServeHTTP), http.MethodOptions, "/api/data", "")
+
+	allowed := rec.Header().Get("Access-Control-Allow-Headers")
+	for _, name := range []string{"Authorization", "Content-Type", cfg.RequestIDHeader, "Idempotency-Key"} {
+		if !strings.Contains(allowed, name) {
+			t.Errorf("Access-Control-Allow-Headers = %q, missing %s", allowed, name)
+		}
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,35 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+const listenBacklogSupported = true
+
+// setListenBacklog changes the backlog of a listening socket. net.Listen
+// always uses somaxconn, but Linux lets listen be called again on a
+// listening socket to change it.
+func setListenBacklog(ln net.Listener, backlog int) error {
+	tcp, ok := ln.(*net.TCPListener)
+	if !ok {
+		return fmt.Errorf("unexpected listener type %T", ln)
+	}
+	rc, err := tcp.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	err = rc.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	return listenErr
+}
+
+// Made with Bob
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+const listenBacklogSupported = false
+
+func setListenBacklog(ln net.Listener, backlog int) error {
+	return nil
+}
+
+// Made with Bob
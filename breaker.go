@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// checkBreaker is a circuit breaker around a dependency check. After
+// threshold consecutive failures it opens and fails immediately without
+// probing; once cooldown has passed the next call probes again, closing
+// the breaker on success or reopening it on failure.
+type checkBreaker struct {
+	name      string
+	check     func(ctx context.Context) error
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	lastErr   error
+	openUntil time.Time
+}
+
+// withBreaker wraps check in a circuit breaker; threshold < 1 disables it
+func withBreaker(name string, check func(ctx context.Context) error, threshold int, cooldown time.Duration) func(ctx context.Context) error {
+	if threshold < 1 {
+		return check
+	}
+	b := &checkBreaker{name: name, check: check, threshold: threshold, cooldown: cooldown}
+	return b.Check
+}
+
+func (b *checkBreaker) Check(ctx context.Context) error {
+	b.mu.Lock()
+	if b.failures >= b.threshold && clock.Now().Before(b.openUntil) {
+		err := b.lastErr
+		b.mu.Unlock()
+		return fmt.Errorf("circuit open after %d consecutive failures: %w", b.failures, err)
+	}
+	b.mu.Unlock()
+
+	err := b.check(ctx)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if b.failures >= b.threshold {
+			log.Printf("Check %s recovered, circuit closed", b.name)
+		}
+		b.failures = 0
+		b.lastErr = nil
+		return nil
+	}
+
+	b.failures++
+	b.lastErr = err
+	if b.failures >= b.threshold {
+		b.openUntil = clock.Now().Add(b.cooldown)
+		log.Printf("Check %s failed %d times in a row, circuit open for %v: %v", b.name, b.failures, b.cooldown, err)
+	}
+	return err
+}
+
+// dependencyChecks are the unguarded dependency checks, probed at startup
+var dependencyChecks []HealthCheck
+
+// registerDependencyCheck registers a readiness check for an external
+// dependency, guarded by a circuit breaker per CHECK_BREAKER_*
+func registerDependencyCheck(name string, check func(ctx context.Context) error) {
+	dependencyChecks = append(dependencyChecks, HealthCheck{Name: name, Check: check})
+	registerReadinessCheck(name, withBreaker(name, check, cfg.CheckBreakerThreshold, cfg.CheckBreakerCooldown))
+}
+
+// Made with Bob
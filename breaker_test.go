@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckBreakerOpensAndCloses(t *testing.T) {
+	captureLogs(t)
+	fake := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	setClock(t, fake)
+
+	var probes int
+	var healthy bool
+	check := withBreaker("db", func(ctx context.Context) error {
+		probes++
+		if healthy {
+			return nil
+		}
+		return errors.New("connection refused")
+	}, 3, 30*time.Second)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		check(ctx)
+	}
+	if probes != 3 {
+		t.Fatalf("probed %d times before opening, want 3", probes)
+	}
+
+	// Open: fails fast without probing
+	err := check(ctx)
+	if err == nil || !strings.Contains(err.Error(), "circuit open") || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("open breaker error = %v", err)
+	}
+	if probes != 3 {
+		t.Errorf("open breaker probed the dependency")
+	}
+
+	// Cooldown over but still failing: one probe, then open again
+	fake.Advance(30 * time.Second)
+	check(ctx)
+	check(ctx)
+	if probes != 4 {
+		t.Errorf("probed %d times after the cooldown, want 4", probes)
+	}
+
+	// Recovered: the next probe after the cooldown closes the breaker
+	healthy = true
+	fake.Advance(30 * time.Second)
+	if err := check(ctx); err != nil {
+		t.Errorf("recovered check = %v", err)
+	}
+	if err := check(ctx); err != nil || probes != 6 {
+		t.Errorf("closed breaker: err %v after %d probes, want nil after 6", err, probes)
+	}
+}
+
+func TestCheckBreakerDisabled(t *testing.T) {
+	var probes int
+	check := withBreaker("db", func(ctx context.Context) error {
+		probes++
+		return errors.New("down")
+	}, 0, time.Minute)
+
+	for i := 0; i < 5; i++ {
+		check(context.Background())
+	}
+	if probes != 5 {
+		t.Errorf("probed %d times with the breaker disabled, want 5", probes)
+	}
+}
+
+// Made with Bob
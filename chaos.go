@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// readinessFault forces readiness to fail until a deadline, for testing
+// load balancer failover without stopping the process
+type readinessFault struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+var chaosReadiness = &readinessFault{}
+
+// Trigger makes readiness fail for d from now and returns the recovery time
+func (f *readinessFault) Trigger(d time.Duration) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.until = clock.Now().Add(d)
+	return f.until
+}
+
+// Check is a readiness check that fails while a fault is active
+func (f *readinessFault) Check() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if clock.Now().Before(f.until) {
+		return errors.New("readiness failure injected until " + f.until.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+type ReadinessFaultResponse struct {
+	Success   bool     `json:"success"`
+	Duration  string   `json:"duration"`
+	Until     JSONTime `json:"until"`
+	Timestamp JSONTime `json:"timestamp"`
+}
+
+// readinessFailHandler flips readiness to failing for CHAOS_READINESS_FAIL_DURATION,
+// or for the ?duration= query parameter when given. /health is unaffected.
+func readinessFailHandler(w http.ResponseWriter, r *http.Request) {
+	d := cfg.ChaosReadinessFailDuration
+	if raw := r.URL.Query().Get("duration"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			writeLocalizedError(w, r, http.StatusBadRequest, "invalid_duration", "duration")
+			return
+		}
+		d = parsed
+	}
+
+	until := chaosReadiness.Trigger(d)
+	log.Printf("Chaos: readiness forced to fail for %v", d)
+
+	writeJSON(w, http.StatusOK, ReadinessFaultResponse{
+		Success:   true,
+		Duration:  d.String(),
+		Until:     responseTime(until),
+		Timestamp: nowFunc(),
+	})
+}
+
+// HeapStats is the subset of runtime.MemStats reported by /admin/gc
+type HeapStats struct {
+	HeapAlloc    uint64 `json:"heap_alloc_bytes"`
+	HeapInuse    uint64 `json:"heap_inuse_bytes"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	HeapReleased uint64 `json:"heap_released_bytes"`
+	NumGC        uint32 `json:"num_gc"`
+}
+
+type GCResponse struct {
+	Success   bool      `json:"success"`
+	Before    HeapStats `json:"before"`
+	After     HeapStats `json:"after"`
+	Duration  string    `json:"duration"`
+	Timestamp JSONTime  `json:"timestamp"`
+}
+
+func readHeapStats() HeapStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return HeapStats{
+		HeapAlloc:    m.HeapAlloc,
+		HeapInuse:    m.HeapInuse,
+		HeapObjects:  m.HeapObjects,
+		HeapReleased: m.HeapReleased,
+		NumGC:        m.NumGC,
+	}
+}
+
+// gcHandler forces a garbage collection and reports heap figures before
+// and after, to tell real leaks from garbage not yet collected
+func gcHandler(w http.ResponseWriter, r *http.Request) {
+	before := readHeapStats()
+	start := clock.Now()
+	runtime.GC()
+	elapsed := clock.Since(start)
+	after := readHeapStats()
+
+	log.Printf("Chaos: forced GC in %v, heap %d -> %d bytes", elapsed, before.HeapAlloc, after.HeapAlloc)
+
+	writeJSON(w, http.StatusOK, GCResponse{
+		Success:   true,
+		Before:    before,
+		After:     after,
+		Duration:  elapsed.String(),
+		Timestamp: nowFunc(),
+	})
+}
+
+// Made with Bob
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// setReadiness starts the test ready, with only the given checks registered
+func setReadiness(t *testing.T, checks ...HealthCheck) {
+	t.Helper()
+	savedChecks, savedStarted := readinessChecks, startupComplete.Load()
+	readinessChecks = checks
+	startupComplete.Store(true)
+	t.Cleanup(func() {
+		readinessChecks = savedChecks
+		startupComplete.Store(savedStarted)
+	})
+}
+
+func TestReadinessFailWindow(t *testing.T) {
+	setConfig(t, func(c *Config) { c.ChaosEnabled = true })
+	setAdmin(t, "secret")
+	captureLogs(t)
+	fake := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	setClock(t, fake)
+	saved := chaosReadiness
+	chaosReadiness = &readinessFault{}
+	t.Cleanup(func() { chaosReadiness = saved })
+	setReadiness(t, HealthCheck{Name: "chaos", Check: func(ctx context.Context) error {
+		return chaosReadiness.Check()
+	}})
+
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/health", healthHandler)
+	router.Handle(http.MethodGet, "/readiness", readinessHandler)
+	router.Handle(http.MethodPost, "/admin/readiness/fail", adminMiddleware(readinessFailHandler))
+
+	if rec := serve(router, http.MethodGet, "/readiness", ""); rec.Code != http.StatusOK {
+		t.Fatalf("before the fault: readiness = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequestWithHeader(http.MethodPost, "/admin/readiness/fail?duration=30s", "X-Admin-Token", "secret"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("trigger: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	fake.Advance(29 * time.Second)
+	if rec := serve(router, http.MethodGet, "/readiness", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("during the window: readiness = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if rec := serve(router, http.MethodGet, "/health", ""); rec.Code != http.StatusOK {
+		t.Errorf("during the window: health = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	fake.Advance(time.Second)
+	if rec := serve(router, http.MethodGet, "/readiness", ""); rec.Code != http.StatusOK {
+		t.Errorf("after the window: readiness = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestReadinessFailRejectsBadDuration(t *testing.T) {
+	setConfig(t, nil)
+	rec := serve(http.HandlerFunc(readinessFailHandler), http.MethodPost, "/admin/readiness/fail?duration=-5s", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestGCReturnsHeapStats(t *testing.T) {
+	setConfig(t, func(c *Config) { c.ChaosEnabled = true })
+	setAdmin(t, "secret")
+	captureLogs(t)
+	handler := adminMiddleware(gcHandler)
+
+	if rec := serve(handler, http.MethodPost, "/admin/gc", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, newRequestWithHeader(http.MethodPost, "/admin/gc", "X-Admin-Token", "secret"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp GCResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.Duration == "" {
+		t.Errorf("response = %+v, want success with a duration", resp)
+	}
+	if resp.After.NumGC <= resp.Before.NumGC {
+		t.Errorf("num_gc %d -> %d, want the forced collection counted", resp.Before.NumGC, resp.After.NumGC)
+	}
+	if resp.Before.HeapInuse == 0 || resp.After.HeapInuse == 0 {
+		t.Errorf("heap figures missing: before %+v, after %+v", resp.Before, resp.After)
+	}
+}
+
+func TestChaosDisabledByDefault(t *testing.T) {
+	t.Setenv("CHAOS_ENABLED", "")
+	if LoadConfig().ChaosEnabled {
+		t.Error("chaos endpoints, /admin/gc included, are enabled by default")
+	}
+}
+
+// Made with Bob
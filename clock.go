@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock abstracts reading the current time so time-dependent behaviour
+// (uptime, timestamps, durations) can be driven deterministically
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+}
+
+// realClock reads the system clock
+type realClock struct{}
+
+func (realClock) Now() time.Time                  { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+var clock Clock = realClock{}
+
+// nowFunc returns the time used for response timestamps,
+// normalized to UTC unless TIMESTAMP_UTC=false
+func nowFunc() JSONTime {
+	return responseTime(clock.Now())
+}
+
+// responseTime prepares t for a response body, applying TIMESTAMP_UTC
+func responseTime(t time.Time) JSONTime {
+	if cfg.TimestampUTC {
+		t = t.UTC()
+	}
+	return JSONTime{t}
+}
+
+// JSONTime is a response timestamp serialized per TIME_FORMAT:
+// rfc3339 (the time.Time default), unix seconds or unixmilli
+type JSONTime struct {
+	time.Time
+}
+
+func (t JSONTime) MarshalJSON() ([]byte, error) {
+	switch strings.ToLower(cfg.TimeFormat) {
+	case "unix":
+		return strconv.AppendInt(nil, t.Unix(), 10), nil
+	case "unixmilli":
+		return strconv.AppendInt(nil, t.UnixMilli(), 10), nil
+	}
+	return t.Time.MarshalJSON()
+}
+
+// JSONDuration is a response duration serialized per UPTIME_FORMAT:
+// human (time.Duration.String, e.g. "1h2m3s"), seconds or iso8601
+type JSONDuration struct {
+	time.Duration
+}
+
+func (d JSONDuration) MarshalJSON() ([]byte, error) {
+	switch strings.ToLower(cfg.UptimeFormat) {
+	case "seconds":
+		return strconv.AppendFloat(nil, d.Seconds(), 'f', -1, 64), nil
+	case "iso8601":
+		return strconv.AppendQuote(nil, isoDuration(d.Duration)), nil
+	}
+	return strconv.AppendQuote(nil, d.String()), nil
+}
+
+// isoDuration formats d as an ISO-8601 duration such as "PT1H2M3.5S".
+// Hours are not rolled up into days, which vary in length.
+func isoDuration(d time.Duration) string {
+	if d == 0 {
+		return "PT0S"
+	}
+
+	var b strings.Builder
+	if d < 0 {
+		b.WriteByte('-')
+		d = -d
+	}
+	b.WriteString("PT")
+	if h := d / time.Hour; h > 0 {
+		b.WriteString(strconv.FormatInt(int64(h), 10) + "H")
+		d -= h * time.Hour
+	}
+	if m := d / time.Minute; m > 0 {
+		b.WriteString(strconv.FormatInt(int64(m), 10) + "M")
+		d -= m * time.Minute
+	}
+	if d > 0 {
+		b.WriteString(strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "S")
+	}
+	return b.String()
+}
+
+// uptime reports how long the server has been running
+func uptime() time.Duration {
+	return clock.Since(startTime)
+}
+
+// Made with Bob
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for tests
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestTimestampUTC(t *testing.T) {
+	local := time.FixedZone("UTC+2", 2*60*60)
+	setClock(t, newFakeClock(time.Date(2024, 3, 1, 14, 30, 0, 0, local)))
+
+	tests := []struct {
+		utc  bool
+		want string
+	}{
+		{true, `"2024-03-01T12:30:00Z"`},
+		{false, `"2024-03-01T14:30:00+02:00"`},
+	}
+	for _, tt := range tests {
+		setConfig(t, func(c *Config) {
+			c.TimestampUTC = tt.utc
+			c.TimeFormat = "rfc3339"
+		})
+		got, err := json.Marshal(nowFunc())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("TIMESTAMP_UTC=%v: timestamp = %s, want %s", tt.utc, got, tt.want)
+		}
+	}
+}
+
+func TestUptime(t *testing.T) {
+	setConfig(t, func(c *Config) { c.UptimeFormat = "seconds" })
+	fake := newFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	setClock(t, fake)
+	saved := startTime
+	startTime = fake.Now()
+	t.Cleanup(func() { startTime = saved })
+
+	fake.Advance(90 * time.Minute)
+	if got := uptime(); got != 90*time.Minute {
+		t.Errorf("uptime() = %v, want 1h30m0s", got)
+	}
+
+	rec := serve(http.HandlerFunc(healthHandler), http.MethodGet, "/health", "")
+	var health struct {
+		Uptime float64 `json:"uptime"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if health.Uptime != 5400 {
+		t.Errorf("/health uptime = %v, want 5400 seconds", health.Uptime)
+	}
+}
+
+func TestTimeFormat(t *testing.T) {
+	ts := JSONTime{time.Date(2024, 3, 1, 12, 30, 0, 250e6, time.UTC)}
+	tests := map[string]string{
+		"rfc3339":   `"2024-03-01T12:30:00.25Z"`,
+		"unix":      `1709296200`,
+		"unixmilli": `1709296200250`,
+		"UNIX":      `1709296200`,
+		"":          `"2024-03-01T12:30:00.25Z"`,
+	}
+	for format, want := range tests {
+		setConfig(t, func(c *Config) { c.TimeFormat = format })
+		got, err := json.Marshal(struct {
+			Timestamp JSONTime `json:"timestamp"`
+		}{ts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want = `{"timestamp":` + want + `}`; string(got) != want {
+			t.Errorf("TIME_FORMAT=%q: %s, want %s", format, got, want)
+		}
+	}
+}
+
+func TestUptimeFormat(t *testing.T) {
+	d := JSONDuration{time.Hour + 2*time.Minute + 3500*time.Millisecond}
+	tests := map[string]string{
+		"human":   `"1h2m3.5s"`,
+		"":        `"1h2m3.5s"`,
+		"seconds": `3723.5`,
+		"iso8601": `"PT1H2M3.5S"`,
+	}
+	for format, want := range tests {
+		setConfig(t, func(c *Config) { c.UptimeFormat = format })
+		got, err := json.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("UPTIME_FORMAT=%q: %s, want %s", format, got, want)
+		}
+	}
+}
+
+func TestISODuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                               "PT0S",
+		90 * time.Second:                "PT1M30S",
+		26 * time.Hour:                  "PT26H",
+		1500 * time.Millisecond:         "PT1.5S",
+		-(time.Minute + 5*time.Second):  "-PT1M5S",
+		time.Hour + 30*time.Millisecond: "PT1H0.03S",
+	}
+	for d, want := range tests {
+		if got := isoDuration(d); got != want {
+			t.Errorf("isoDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+// Made with Bob
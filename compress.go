@@ -0,0 +1,126 @@
+package main
+
+import (
+	"compress/gzip"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// streamingContentTypes are never compressed: gzip buffers output, which
+// would hold back events until the stream ends
+var streamingContentTypes = map[string]bool{
+	"text/event-stream":    true,
+	"application/x-ndjson": true,
+}
+
+// gzipMiddleware compresses responses for clients that accept gzip when
+// COMPRESS_RESPONSES is set. Streaming content types and routes wrapped
+// with uncompressed are sent as-is.
+func gzipMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if !cfg.CompressResponses {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		next(gw, r)
+	}
+}
+
+// uncompressed opts a route out of response compression
+func uncompressed(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if found, ok := findWriter(w, func(w http.ResponseWriter) bool {
+			_, ok := w.(*gzipResponseWriter)
+			return ok
+		}); ok {
+			found.(*gzipResponseWriter).skip = true
+		}
+		h(w, r)
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding value allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
+
+// gzipResponseWriter decides on the first WriteHeader or Write whether to
+// compress, based on the response headers set by then
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	skip        bool
+	wroteHeader bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if !w.skip && h.Get("Content-Encoding") == "" && !streamingContentTypes[mediaType] &&
+		status != http.StatusNoContent && status != http.StatusNotModified {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		// Sniff now, as net/http would otherwise sniff the compressed bytes
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+// Flush pushes compressed data written so far to the client
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close writes the gzip trailer, if the response was compressed
+func (w *gzipResponseWriter) Close() {
+	if w.gz == nil {
+		return
+	}
+	if err := w.gz.Close(); err != nil && !isClientDisconnect(err) {
+		slog.Error("Failed to finish compressed response", "error", err)
+	}
+}
+
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Made with Bob
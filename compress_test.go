@@ -0,0 +1,106 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveGzip(h http.HandlerFunc) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h(rec, newRequestWithHeader(http.MethodGet, "/", "Accept-Encoding", "gzip"))
+	return rec
+}
+
+func TestGzipSkipsStreamingResponses(t *testing.T) {
+	setConfig(t, func(c *Config) { c.CompressResponses = true })
+
+	for _, contentType := range []string{"text/event-stream", "application/x-ndjson; charset=utf-8"} {
+		handler := gzipMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			io.WriteString(w, "data: tick\n\n")
+			http.NewResponseController(w).Flush()
+		})
+
+		rec := serveGzip(handler)
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%s: Content-Encoding = %q, want none", contentType, got)
+		}
+		if got := rec.Body.String(); got != "data: tick\n\n" {
+			t.Errorf("%s: body = %q, want the events as written", contentType, got)
+		}
+		if !rec.Flushed {
+			t.Errorf("%s: Flush did not reach the client", contentType)
+		}
+	}
+}
+
+func TestGzipCompressesJSON(t *testing.T) {
+	setConfig(t, func(c *Config) { c.CompressResponses = true })
+	handler := gzipMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"message": "hello"})
+	})
+
+	rec := serveGzip(handler)
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "{\"message\":\"hello\"}\n" {
+		t.Errorf("decompressed body = %q", body)
+	}
+}
+
+func TestGzipUncompressedRoute(t *testing.T) {
+	setConfig(t, func(c *Config) { c.CompressResponses = true })
+	handler := gzipMiddleware(uncompressed(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "chunk\n")
+		http.NewResponseController(w).Flush()
+	}))
+
+	rec := serveGzip(handler)
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none for an opted-out route", got)
+	}
+	if got := rec.Body.String(); got != "chunk\n" || !rec.Flushed {
+		t.Errorf("body = %q, flushed = %v; want the chunk flushed as written", got, rec.Flushed)
+	}
+}
+
+func TestGzipSkipsRawEcho(t *testing.T) {
+	setConfig(t, func(c *Config) { c.CompressResponses = true })
+	router := newAPIRouter(t)
+	router.Group("/v2", func(g *RouteGroup) { registerAPIv2(g) })
+	handler := gzipMiddleware(router.ServeHTTP)
+
+	for _, path := range []string{"/api/echo/raw", "/v2/api/echo/raw"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("raw bytes"))
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("Content-Type", "text/plain")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%s: Content-Encoding = %q, want none", path, got)
+		}
+		if got := rec.Header().Get("Content-Length"); got != "9" {
+			t.Errorf("%s: Content-Length = %q, want 9", path, got)
+		}
+		if got := rec.Body.String(); got != "raw bytes" {
+			t.Errorf("%s: body = %q, want the upload verbatim", path, got)
+		}
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the server settings read from the environment
+type Config struct {
+	Port           string
+	ReusePort      bool
+	ListenBacklog  int
+	MaxConnections int
+	MaxConnPerIP   int
+
+	// Proxies whose address is shared by many clients
+	TrustedProxies []netip.Prefix
+
+	// PROXY protocol v1/v2 from a load balancer in front of the server
+	ProxyProtocol     bool
+	ProxyProtocolMode string
+
+	// Time allowed to read request headers, guarding against slowloris
+	ReadHeaderTimeout time.Duration
+
+	// Time allowed to read a request and write its response. Declared bodies
+	// earn extra read time at ReadTimeoutBytesPerSec, up to ReadTimeoutMax.
+	ReadTimeout            time.Duration
+	ReadTimeoutBytesPerSec int
+	ReadTimeoutMax         time.Duration
+	WriteTimeout           time.Duration
+
+	// Default time limit for handlers; RouteTimeouts, keyed by method and
+	// unversioned pattern, override it per route. Handlers that run over
+	// get TimeoutStatus.
+	HandlerTimeout time.Duration
+	RouteTimeouts  map[string]time.Duration
+	TimeoutStatus  int
+
+	// Most routes the router accepts; 0 is unlimited
+	MaxRoutes int
+
+	// Retry-After for 429s and 503s without a more specific value, and the
+	// random jitter added to every Retry-After
+	RetryAfter       time.Duration
+	RetryAfterJitter time.Duration
+
+	// Per-client, per-route request rates; writes to /api/data use their own
+	RateLimit        RateLimit
+	WriteRateLimit   RateLimit
+	RateLimitHeaders bool
+
+	// TLS is enabled when a certificate and key are configured
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSMinVersion   string
+	TLSCipherSuites []string
+	TLSClientCA     string
+
+	// Time after the listener opens before non-probe requests are served
+	StartupWarmup time.Duration
+
+	// How long to wait for dependencies before listening, and whether to
+	// exit or start degraded if they are still failing
+	StartupProbeTimeout time.Duration
+	StartupFailFast     bool
+
+	// Shutdown
+	PreShutdownDelay time.Duration
+	ShutdownTimeout  time.Duration
+	IdleDrain        time.Duration
+	ShutdownSignals  []string
+
+	// Shorter timeout for SIGINT, skipping the delay and idle drain
+	SIGINTShutdownTimeout time.Duration
+
+	// Panic handling: "recover" or "crash"
+	PanicMode string
+
+	// API authentication
+	APIToken        string
+	AuthExemptPaths map[string]bool
+
+	// Admin endpoints
+	AdminToken         string
+	RecentRequestsSize int
+	AuditLogOutput     string
+
+	// Chaos testing endpoints
+	ChaosEnabled               bool
+	ChaosReadinessFailDuration time.Duration
+
+	// Initial feature flag values
+	FeatureFlags map[string]bool
+
+	// Message echoed by /api/echo when none is given; with EchoEmptyOK
+	// a missing message is answered with 200 instead of 400
+	EchoDefault string
+	EchoEmptyOK bool
+
+	// Data records
+	StrictDelete  bool
+	AsyncData     bool
+	DataWorkers   int
+	DataQueueSize int
+	JobRetention  time.Duration
+
+	// Readiness
+	WorkDir               string
+	CheckBreakerThreshold int
+	CheckBreakerCooldown  time.Duration
+	HealthCacheTTL        time.Duration
+
+	// HTTP dependencies probed by readiness through one shared client
+	DependencyURLs       []string
+	CheckHTTPTimeout     time.Duration
+	CheckMaxIdleConns    int
+	CheckIdleConnTimeout time.Duration
+
+	// Maintenance mode; MaintenanceMode is the startup value, reloaded on SIGHUP
+	MaintenanceMode          bool
+	MaintenanceRetryAfter    time.Duration
+	MaintenanceFailReadiness bool
+
+	// CORS
+	CORSAllowedMethods []string
+	CORSExposeHeaders  []string
+	CORSMaxAge         int
+	OptionsStatus      int
+
+	// Request limits
+	MaxPathLength  int
+	MaxQueryParams int
+	MaxHeaders     int
+	MaxBodyBytes   int
+
+	// Upload requests handled at once, apart from other traffic; 0 is unlimited
+	MaxConcurrentUploads int
+
+	// Unread request body bytes discarded after a handler returns, so the
+	// connection can be kept alive
+	DrainBodyMaxBytes int
+
+	// Reject HTTP/1.0 requests that omit Host
+	RequireHostHeader bool
+
+	// Oldest HTTP version served, e.g. "1.1"; empty allows all
+	MinHTTPVersion string
+
+	// Answer TRACE and TRACK with 405
+	BlockTraceMethods bool
+
+	// Content-Encodings accepted on request bodies (gzip, deflate)
+	RequestEncodings map[string]bool
+
+	// Reject request bodies whose Content-Type charset is not accepted
+	CheckRequestCharset bool
+	AcceptedCharsets    map[string]bool
+
+	// Gzip responses for clients that accept it
+	CompressResponses bool
+
+	// Languages negotiated from Accept-Language
+	SupportedLanguages []string
+	DefaultLanguage    string
+
+	// Responses
+	CacheControlCacheable string
+	CacheControlDynamic   string
+	CustomHeaders         http.Header
+	ErrorDetail           string
+	TimestampUTC          bool
+	TimeFormat            string
+	UptimeFormat          string
+	EnvelopeResponses     bool
+	PrettyJSON            bool
+	AddBodyChecksum       bool
+	JSONFieldCase         string
+	OmitEmptyFields       bool
+
+	// Request logging
+	LogLevel          string
+	LogFormat         string
+	LogOutput         string
+	LogFields         []string
+	LogExcludePaths   map[string]bool
+	LogExcludedErrors bool
+
+	SlowRequestThreshold time.Duration
+
+	// Header carrying the request ID in both directions
+	RequestIDHeader string
+
+	// Flag repeated Idempotency-Key/request ID values as likely retries
+	RetryDetectionWindow  time.Duration
+	RetryDetectionMaxKeys int
+
+	// Metrics
+	MetricsEnabled bool
+
+	// Tracing
+	OTelEnabled     bool
+	OTelEndpoint    string
+	OTelServiceName string
+}
+
+var cfg Config
+
+// LoadConfig reads the server configuration from environment variables
+// Values from CONFIG_FILE are used for any setting not present in the environment.
+func LoadConfig() Config {
+	fileValues = loadConfigFile(os.Getenv("CONFIG_FILE"))
+	knownKeys = make(map[string]bool)
+
+	requestIDHeader := getEnv("REQUEST_ID_HEADER", "X-Request-ID")
+
+	c := Config{
+		Port:           getEnv("PORT", "8080"),
+		ReusePort:      getEnvBool("REUSE_PORT", false),
+		ListenBacklog:  getEnvInt("LISTEN_BACKLOG", 0),
+		MaxConnections: getEnvInt("MAX_CONNECTIONS", 0),
+		MaxConnPerIP:   getEnvInt("MAX_CONN_PER_IP", 0),
+
+		TrustedProxies: parseTrustedProxies(getEnvList("TRUSTED_PROXIES")),
+
+		ProxyProtocol:     getEnvBool("PROXY_PROTOCOL", false),
+		ProxyProtocolMode: strings.ToLower(getEnv("PROXY_PROTOCOL_MODE", proxyModeRequire)),
+
+		ReadHeaderTimeout: getEnvDuration("READ_HEADER_TIMEOUT", 5*time.Second),
+
+		ReadTimeout:            getEnvDuration("READ_TIMEOUT", 15*time.Second),
+		ReadTimeoutBytesPerSec: getEnvInt("READ_TIMEOUT_BYTES_PER_SEC", 0),
+		ReadTimeoutMax:         getEnvDuration("READ_TIMEOUT_MAX", 5*time.Minute),
+		WriteTimeout:           getEnvDuration("WRITE_TIMEOUT", 15*time.Second),
+
+		HandlerTimeout: getEnvDuration("HANDLER_TIMEOUT", 0),
+		RouteTimeouts:  parseRouteTimeouts(getEnvList("ROUTE_TIMEOUTS")),
+		TimeoutStatus:  getEnvInt("TIMEOUT_STATUS", http.StatusGatewayTimeout),
+
+		MaxRoutes: getEnvInt("MAX_ROUTES", 0),
+
+		RetryAfter:       getEnvDuration("RETRY_AFTER", time.Second),
+		RetryAfterJitter: getEnvDuration("RETRY_AFTER_JITTER", 0),
+
+		RateLimit:        RateLimit{RPS: getEnvInt("RATE_LIMIT_RPS", 0), Burst: getEnvInt("RATE_LIMIT_BURST", 0)},
+		WriteRateLimit:   RateLimit{RPS: getEnvInt("RATE_LIMIT_WRITE_RPS", 0), Burst: getEnvInt("RATE_LIMIT_WRITE_BURST", 0)},
+		RateLimitHeaders: getEnvBool("RATE_LIMIT_HEADERS", true),
+
+		TLSCertFile:     getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:      getEnv("TLS_KEY_FILE", ""),
+		TLSMinVersion:   getEnv("TLS_MIN_VERSION", "1.2"),
+		TLSCipherSuites: getEnvList("TLS_CIPHER_SUITES"),
+		TLSClientCA:     getEnv("TLS_CLIENT_CA", ""),
+
+		StartupWarmup:       getEnvDuration("STARTUP_WARMUP", 0),
+		StartupProbeTimeout: getEnvDuration("STARTUP_PROBE_TIMEOUT", 0),
+		StartupFailFast:     getEnvBool("STARTUP_FAIL_FAST", true),
+
+		PreShutdownDelay: getEnvDuration("PRE_SHUTDOWN_DELAY", 0),
+		ShutdownTimeout:  getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		IdleDrain:        getEnvDuration("IDLE_DRAIN", 0),
+		ShutdownSignals:  getEnvListDefault("SHUTDOWN_SIGNALS", []string{"SIGINT", "SIGTERM"}),
+
+		SIGINTShutdownTimeout: getEnvDuration("SIGINT_SHUTDOWN_TIMEOUT", 0),
+
+		PanicMode: getEnv("PANIC_MODE", "recover"),
+
+		APIToken:        getEnv("API_TOKEN", ""),
+		AuthExemptPaths: getEnvSetDefault("AUTH_EXEMPT_PATHS", "/"),
+
+		AdminToken:         getEnv("ADMIN_TOKEN", ""),
+		RecentRequestsSize: getEnvInt("RECENT_REQUESTS_SIZE", 100),
+		AuditLogOutput:     getEnv("AUDIT_LOG_OUTPUT", "stderr"),
+
+		ChaosEnabled:               getEnvBool("CHAOS_ENABLED", false),
+		ChaosReadinessFailDuration: getEnvDuration("CHAOS_READINESS_FAIL_DURATION", 30*time.Second),
+
+		FeatureFlags: getEnvFlags("FEATURE_FLAGS"),
+
+		EchoDefault: getEnv("ECHO_DEFAULT", ""),
+		EchoEmptyOK: getEnvBool("ECHO_EMPTY_OK", false),
+
+		StrictDelete:  getEnvBool("STRICT_DELETE", false),
+		AsyncData:     getEnvBool("ASYNC_DATA", false),
+		DataWorkers:   getEnvInt("DATA_WORKERS", 4),
+		DataQueueSize: getEnvInt("DATA_QUEUE_SIZE", 100),
+		JobRetention:  getEnvDuration("JOB_RETENTION", 10*time.Minute),
+
+		WorkDir:               getEnv("WORK_DIR", ""),
+		CheckBreakerThreshold: getEnvInt("CHECK_BREAKER_THRESHOLD", 3),
+		CheckBreakerCooldown:  getEnvDuration("CHECK_BREAKER_COOLDOWN", 30*time.Second),
+		HealthCacheTTL:        getEnvDuration("HEALTH_CACHE_TTL", 0),
+
+		DependencyURLs:       getEnvList("DEPENDENCY_URLS"),
+		CheckHTTPTimeout:     getEnvDuration("CHECK_HTTP_TIMEOUT", 2*time.Second),
+		CheckMaxIdleConns:    getEnvInt("CHECK_MAX_IDLE_CONNS", 10),
+		CheckIdleConnTimeout: getEnvDuration("CHECK_IDLE_CONN_TIMEOUT", 90*time.Second),
+
+		MaintenanceMode:          getEnvBool("MAINTENANCE_MODE", false),
+		MaintenanceRetryAfter:    getEnvDuration("MAINTENANCE_RETRY_AFTER", 5*time.Minute),
+		MaintenanceFailReadiness: getEnvBool("MAINTENANCE_FAIL_READINESS", false),
+
+		CORSAllowedMethods: getEnvListDefault("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+		CORSExposeHeaders:  getEnvListDefault("CORS_EXPOSE_HEADERS", []string{requestIDHeader}),
+		CORSMaxAge:         getEnvInt("CORS_MAX_AGE", 600),
+		OptionsStatus:      getEnvInt("OPTIONS_STATUS", http.StatusOK),
+
+		MaxPathLength:  getEnvInt("MAX_PATH_LENGTH", 2048),
+		MaxQueryParams: getEnvInt("MAX_QUERY_PARAMS", 100),
+		MaxHeaders:     getEnvInt("MAX_HEADERS", 100),
+		MaxBodyBytes:   getEnvInt("MAX_BODY_BYTES", 0),
+
+		MaxConcurrentUploads: getEnvInt("MAX_CONCURRENT_UPLOADS", 0),
+
+		DrainBodyMaxBytes: getEnvInt("DRAIN_BODY_MAX_BYTES", 0),
+
+		RequireHostHeader: getEnvBool("REQUIRE_HOST_HEADER", false),
+
+		MinHTTPVersion: getEnv("MIN_HTTP_VERSION", ""),
+
+		BlockTraceMethods: getEnvBool("BLOCK_TRACE_METHODS", true),
+
+		RequestEncodings: getEnvSet("REQUEST_CONTENT_ENCODINGS"),
+
+		CheckRequestCharset: getEnvBool("CHECK_REQUEST_CHARSET", false),
+		AcceptedCharsets:    getEnvSetDefault("ACCEPTED_CHARSETS", "utf-8"),
+
+		CompressResponses: getEnvBool("COMPRESS_RESPONSES", false),
+
+		SupportedLanguages: getEnvListDefault("SUPPORTED_LANGUAGES", []string{"en", "fr"}),
+		DefaultLanguage:    getEnv("DEFAULT_LANGUAGE", "en"),
+
+		CacheControlCacheable: getEnv("CACHE_CONTROL_CACHEABLE", "public, max-age=60"),
+		CacheControlDynamic:   getEnv("CACHE_CONTROL_DYNAMIC", "no-store"),
+		CustomHeaders:         getEnvHeaders("CUSTOM_HEADERS"),
+		ErrorDetail:           getEnv("ERROR_DETAIL", "minimal"),
+		TimestampUTC:          getEnvBool("TIMESTAMP_UTC", true),
+		TimeFormat:            getEnv("TIME_FORMAT", "rfc3339"),
+		UptimeFormat:          getEnv("UPTIME_FORMAT", "human"),
+		EnvelopeResponses:     getEnvBool("ENVELOPE_RESPONSES", false),
+		PrettyJSON:            getEnvBool("PRETTY_JSON", false),
+		AddBodyChecksum:       getEnvBool("ADD_BODY_CHECKSUM", false),
+		JSONFieldCase:         getEnv("JSON_FIELD_CASE", "snake"),
+		OmitEmptyFields:       getEnvBool("OMIT_EMPTY_FIELDS", true),
+
+		LogLevel:          getEnv("LOG_LEVEL", "info"),
+		LogFormat:         getEnv("LOG_FORMAT", "text"),
+		LogOutput:         getEnv("LOG_OUTPUT", "stderr"),
+		LogFields:         parseLogFields(getEnvList("LOG_FIELDS")),
+		LogExcludePaths:   getEnvSet("LOG_EXCLUDE_PATHS"),
+		LogExcludedErrors: getEnvBool("LOG_EXCLUDED_ERRORS", true),
+
+		SlowRequestThreshold: getEnvDuration("SLOW_REQUEST_THRESHOLD", time.Second),
+
+		RequestIDHeader: requestIDHeader,
+
+		RetryDetectionWindow:  getEnvDuration("RETRY_DETECTION_WINDOW", time.Minute),
+		RetryDetectionMaxKeys: getEnvInt("RETRY_DETECTION_MAX_KEYS", 10000),
+
+		MetricsEnabled: getEnvBool("METRICS_ENABLED", true),
+
+		OTelEnabled:     getEnvBool("OTEL_ENABLED", false),
+		OTelEndpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"),
+		OTelServiceName: getEnv("OTEL_SERVICE_NAME", "go-http-server"),
+	}
+
+	for key := range fileValues {
+		if !knownKeys[key] {
+			log.Printf("Warning: unknown key %q in config file, ignoring", key)
+		}
+	}
+	return c
+}
+
+var (
+	// fileValues holds settings read from CONFIG_FILE, keyed like env vars
+	fileValues map[string]string
+	// knownKeys records every setting LoadConfig asked for
+	knownKeys map[string]bool
+)
+
+// loadConfigFile reads a flat JSON object whose keys are the environment
+// variable names, e.g. {"PORT": 9090, "LOG_EXCLUDE_PATHS": ["/health"]}
+func loadConfigFile(path string) map[string]string {
+	values, err := readConfigFile(path)
+	if err != nil {
+		log.Fatalf("Config error: %v", err)
+	}
+	return values
+}
+
+// readConfigFile is loadConfigFile without the fatal exit, for reloads
+func readConfigFile(path string) (map[string]string, error) {
+	values := make(map[string]string)
+	if path == "" {
+		return values, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for key, v := range raw {
+		if list, ok := v.([]interface{}); ok {
+			items := make([]string, len(list))
+			for i, item := range list {
+				items[i] = configValueString(item)
+			}
+			values[key] = strings.Join(items, ",")
+			continue
+		}
+		values[key] = configValueString(v)
+	}
+	return values, nil
+}
+
+func configValueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// lookupSetting returns the environment value for key, falling back to the config file
+func lookupSetting(key string) string {
+	if knownKeys != nil {
+		knownKeys[key] = true
+	}
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fileValues[key]
+}
+
+func getEnv(key, fallback string) string {
+	if value := lookupSetting(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value := lookupSetting(key)
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Warning: invalid boolean for %s=%q, using %v", key, value, fallback)
+		return fallback
+	}
+	return b
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := lookupSetting(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: invalid integer for %s=%q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := lookupSetting(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid duration for %s=%q, using %v", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// getEnvList splits a comma-separated variable, trimming blanks
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(lookupSetting(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvListDefault is getEnvList with a fallback for when the variable is unset
+func getEnvListDefault(key string, fallback []string) []string {
+	if list := getEnvList(key); len(list) > 0 {
+		return list
+	}
+	return fallback
+}
+
+func getEnvSet(key string) map[string]bool {
+	set := make(map[string]bool)
+	for _, item := range getEnvList(key) {
+		set[item] = true
+	}
+	return set
+}
+
+// getEnvHeaders parses semicolon-separated "Key: Value" pairs.
+// Semicolons are used because header values commonly contain commas.
+func getEnvHeaders(key string) http.Header {
+	headers := make(http.Header)
+	for _, pair := range strings.Split(lookupSetting(key), ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !validHeaderName(name) {
+			log.Printf("Warning: skipping malformed %s entry %q", key, pair)
+			continue
+		}
+		headers.Add(name, value)
+	}
+	return headers
+}
+
+// getEnvSetDefault is getEnvSet with fallback entries for when the variable is unset
+func getEnvSetDefault(key string, fallback ...string) map[string]bool {
+	set := getEnvSet(key)
+	if len(set) == 0 {
+		for _, item := range fallback {
+			set[item] = true
+		}
+	}
+	return set
+}
+
+// getEnvFlags parses comma-separated name=bool pairs, e.g. "new_ui=true,beta=false"
+func getEnvFlags(key string) map[string]bool {
+	flags := make(map[string]bool)
+	for _, pair := range getEnvList(key) {
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if !ok || name == "" || err != nil {
+			log.Printf("Warning: skipping malformed %s entry %q", key, pair)
+			continue
+		}
+		flags[name] = enabled
+	}
+	return flags
+}
+
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > 0x7e || c <= 0x20 || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Made with Bob
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFileWithEnvOverride(t *testing.T) {
+	logs := captureLogs(t)
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, `{
+		"PORT": 9090,
+		"LOG_LEVEL": "debug",
+		"LOG_EXCLUDE_PATHS": ["/health", "/metrics"],
+		"NOT_A_SETTING": true
+	}`))
+	t.Setenv("PORT", "7070")
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("LOG_EXCLUDE_PATHS", "")
+
+	c := LoadConfig()
+
+	if c.Port != "7070" {
+		t.Errorf("Port = %q, want the env value 7070", c.Port)
+	}
+	if c.LogLevel != "debug" {
+		t.Errorf("LogLevel = %q, want the file value debug", c.LogLevel)
+	}
+	if !c.LogExcludePaths["/health"] || !c.LogExcludePaths["/metrics"] {
+		t.Errorf("LogExcludePaths = %v, want the file list", c.LogExcludePaths)
+	}
+	if !strings.Contains(logs.String(), "NOT_A_SETTING") {
+		t.Errorf("no warning for the unknown key: %s", logs)
+	}
+}
+
+func TestReadConfigFileErrors(t *testing.T) {
+	if _, err := readConfigFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file: no error")
+	}
+	if _, err := readConfigFile(writeConfigFile(t, `{"PORT":`)); err == nil {
+		t.Error("malformed file: no error")
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// ipConnTracker counts open connections per client IP using http.Server.ConnState.
+// A connection is counted once its first request has been read, not at
+// StateNew: that hook runs in the server's accept loop, and resolving the
+// client address there would wait for a PROXY protocol header, letting one
+// silent client stall every other accept.
+type ipConnTracker struct {
+	mu      sync.Mutex
+	conns   map[netip.Addr]int
+	counted map[net.Conn]netip.Addr
+}
+
+var connTracker = newIPConnTracker()
+
+func newIPConnTracker() *ipConnTracker {
+	return &ipConnTracker{conns: make(map[netip.Addr]int), counted: make(map[net.Conn]netip.Addr)}
+}
+
+// ConnState is installed as the server's ConnState hook
+func (t *ipConnTracker) ConnState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateActive:
+		t.mu.Lock()
+		_, seen := t.counted[conn]
+		t.mu.Unlock()
+		if seen {
+			return
+		}
+		// The request has been read, so any PROXY header has been too
+		ip, ok := remoteIP(conn.RemoteAddr().String())
+		if !ok {
+			return
+		}
+		t.mu.Lock()
+		t.counted[conn] = ip
+		t.conns[ip]++
+		t.mu.Unlock()
+	case http.StateClosed, http.StateHijacked:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		ip, seen := t.counted[conn]
+		if !seen {
+			return
+		}
+		delete(t.counted, conn)
+		if t.conns[ip]--; t.conns[ip] <= 0 {
+			delete(t.conns, ip)
+		}
+	}
+}
+
+func (t *ipConnTracker) Count(ip netip.Addr) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conns[ip]
+}
+
+// connLimitMiddleware answers 429 and closes the connection when the client
+// IP has more than MAX_CONN_PER_IP connections open. Trusted proxies are
+// exempt because every client behind them shares their address.
+func connLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if cfg.MaxConnPerIP <= 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip, ok := remoteIP(r.RemoteAddr)
+		if !ok || trustedProxy(ip) || connTracker.Count(ip) <= cfg.MaxConnPerIP {
+			next(w, r)
+			return
+		}
+
+		w.Header().Set("Connection", "close")
+		setRetryAfter(w, cfg.RetryAfter)
+		writeLocalizedError(w, r, http.StatusTooManyRequests, "too_many_connections")
+	}
+}
+
+// trustedProxy reports whether ip is covered by TRUSTED_PROXIES
+func trustedProxy(ip netip.Addr) bool {
+	for _, prefix := range cfg.TrustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(addr string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+// parseTrustedProxies turns IPs and CIDR ranges into prefixes, warning about invalid entries
+func parseTrustedProxies(entries []string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip, err := netip.ParseAddr(entry)
+			if err != nil {
+				log.Printf("Warning: skipping malformed TRUSTED_PROXIES entry %q", entry)
+				continue
+			}
+			ip = ip.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			log.Printf("Warning: skipping malformed TRUSTED_PROXIES entry %q", entry)
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// Made with Bob
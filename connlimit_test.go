@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+// connLimitServer serves okHandler behind connLimitMiddleware, tracking
+// connections with a fresh tracker
+func connLimitServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	saved := connTracker
+	connTracker = newIPConnTracker()
+	t.Cleanup(func() { connTracker = saved })
+
+	srv := httptest.NewUnstartedServer(connLimitMiddleware(okHandler))
+	srv.Config.ConnState = connTracker.ConnState
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// getOnNewConn opens a connection, sends one GET and leaves the connection open
+func getOnNewConn(t *testing.T, srv *httptest.Server) int {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/", nil)
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestPerIPConnectionLimit(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.MaxConnPerIP = 2
+		c.TrustedProxies = nil
+	})
+	srv := connLimitServer(t)
+
+	for i := 1; i <= 2; i++ {
+		if status := getOnNewConn(t, srv); status != http.StatusOK {
+			t.Fatalf("connection %d: status = %d, want %d", i, status, http.StatusOK)
+		}
+	}
+	if status := getOnNewConn(t, srv); status != http.StatusTooManyRequests {
+		t.Errorf("connection over the limit: status = %d, want %d", status, http.StatusTooManyRequests)
+	}
+}
+
+func TestPerIPConnectionLimitExemptsTrustedProxies(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.MaxConnPerIP = 1
+		c.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	})
+	srv := connLimitServer(t)
+
+	for i := 1; i <= 3; i++ {
+		if status := getOnNewConn(t, srv); status != http.StatusOK {
+			t.Errorf("connection %d from a trusted proxy: status = %d, want %d", i, status, http.StatusOK)
+		}
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Cap on the decompressed size of a request body, guarding against zip bombs
+const maxDecompressedBodyBytes = 10 << 20
+
+// decompressMiddleware transparently decodes request bodies sent with a
+// Content-Encoding listed in REQUEST_CONTENT_ENCODINGS
+func decompressMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+			next(w, r)
+			return
+		}
+
+		if encoding == "x-gzip" {
+			encoding = "gzip"
+		}
+		if !cfg.RequestEncodings[encoding] {
+			writeLocalizedError(w, r, http.StatusUnsupportedMediaType, "unsupported_content_encoding", encoding)
+			return
+		}
+
+		var body io.ReadCloser
+		var err error
+		switch encoding {
+		case "gzip":
+			body, err = gzip.NewReader(r.Body)
+		case "deflate":
+			body, err = zlib.NewReader(r.Body)
+		default:
+			writeLocalizedError(w, r, http.StatusUnsupportedMediaType, "unsupported_content_encoding", encoding)
+			return
+		}
+		if err != nil {
+			writeLocalizedError(w, r, http.StatusBadRequest, "malformed_body", encoding)
+			return
+		}
+		defer body.Close()
+
+		r.Body = http.MaxBytesReader(w, body, maxDecompressedBodyBytes)
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+
+		next(w, r)
+	}
+}
+
+// Made with Bob
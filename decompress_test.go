@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveEncoded posts body to h with the given Content-Encoding
+func serveEncoded(h http.HandlerFunc, target, encoding string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", encoding)
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func TestDecompressGzipJSONBody(t *testing.T) {
+	setConfig(t, func(c *Config) { c.RequestEncodings = map[string]bool{"gzip": true} })
+	router := newAPIRouter(t)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`{"name":"zipped","value":"compressed upload"}`))
+	zw.Close()
+
+	rec := serveEncoded(decompressMiddleware(router.ServeHTTP), "/api/data", "gzip", buf.Bytes())
+	if rec.Code >= 300 {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if got, ok := dataStore.Get("zipped"); !ok || got.Value != "compressed upload" {
+		t.Errorf("stored record = %+v, %v", got, ok)
+	}
+}
+
+func TestDecompressRejectsBadBodies(t *testing.T) {
+	setConfig(t, func(c *Config) { c.RequestEncodings = map[string]bool{"gzip": true} })
+	router := newAPIRouter(t)
+
+	tests := []struct {
+		name     string
+		encoding string
+		want     int
+	}{
+		{"malformed gzip", "gzip", http.StatusBadRequest},
+		{"encoding not allowed", "deflate", http.StatusUnsupportedMediaType},
+		{"unknown encoding", "br", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveEncoded(decompressMiddleware(router.ServeHTTP), "/api/data", tt.encoding, []byte(`{"name":"plain"}`))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if !strings.Contains(rec.Body.String(), `"error"`) {
+				t.Errorf("body = %s, want an error response", rec.Body)
+			}
+		})
+	}
+}
+
+// Made with Bob
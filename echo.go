@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Maximum number of body bytes reflected by /api/echo/full
+const maxEchoBodyBytes = 64 << 10
+
+// Maximum body size mirrored by /api/echo/raw; larger bodies get 413
+const maxRawEchoBodyBytes = 1 << 20
+
+// Headers whose values are never reflected back to the client
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+	"X-Admin-Token":       true,
+}
+
+type FullEchoResponse struct {
+	Method    string              `json:"method"`
+	Path      string              `json:"path"`
+	Query     map[string][]string `json:"query"`
+	Headers   map[string][]string `json:"headers"`
+	Body      string              `json:"body,omitempty"`
+	Truncated bool                `json:"truncated,omitempty"`
+	Timestamp JSONTime            `json:"timestamp"`
+}
+
+// fullEchoHandler reflects the whole request back, similar to httpbin's /anything
+func fullEchoHandler(r *http.Request) (int, interface{}, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxEchoBodyBytes+1))
+	if err != nil {
+		return 0, nil, apiError(http.StatusBadRequest, "unreadable_body")
+	}
+
+	truncated := len(body) > maxEchoBodyBytes
+	if truncated {
+		body = body[:maxEchoBodyBytes]
+	}
+
+	return http.StatusOK, FullEchoResponse{
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     r.URL.Query(),
+		Headers:   redactHeaders(r.Header),
+		Body:      string(body),
+		Truncated: truncated,
+		Timestamp: nowFunc(),
+	}, nil
+}
+
+// rawEchoHandler mirrors the request body back verbatim with the same
+// Content-Type, for testing proxies and middleware with arbitrary payloads
+func rawEchoHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRawEchoBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeLocalizedError(w, r, http.StatusRequestEntityTooLarge, "body_too_large", maxRawEchoBodyBytes)
+			return
+		}
+		writeLocalizedError(w, r, http.StatusBadRequest, "unreadable_body")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	// The body is client-controlled, so browsers must not sniff or run it
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil && !isClientDisconnect(err) {
+		slog.Error("Failed to write echoed body", "error", err)
+	}
+}
+
+// decodeBase64 accepts standard or URL-safe base64, padded or not,
+// since clients differ in how they make base64 query-string safe
+func decodeBase64(s string) ([]byte, error) {
+	var err error
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.URLEncoding,
+		base64.RawStdEncoding,
+		base64.RawURLEncoding,
+	} {
+		var b []byte
+		if b, err = enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, err
+}
+
+func redactHeaders(h http.Header) map[string][]string {
+	headers := make(map[string][]string, len(h))
+	for name, values := range h {
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			headers[name] = []string{"[REDACTED]"}
+			continue
+		}
+		headers[name] = values
+	}
+	return headers
+}
+
+// Made with Bob
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFullEchoReflectsRequest(t *testing.T) {
+	setConfig(t, nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/echo/full?a=1&a=2&b=x", strings.NewReader("hello"))
+	req.Header.Set("X-Custom", "value")
+	req.Header.Set("Authorization", "Bearer secret")
+
+	status, body, err := fullEchoHandler(req)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("fullEchoHandler = %d, %v", status, err)
+	}
+	resp := body.(FullEchoResponse)
+
+	if resp.Method != http.MethodPost {
+		t.Errorf("method = %q", resp.Method)
+	}
+	if resp.Path != "/api/echo/full" {
+		t.Errorf("path = %q", resp.Path)
+	}
+	if want := map[string][]string{"a": {"1", "2"}, "b": {"x"}}; !reflect.DeepEqual(resp.Query, want) {
+		t.Errorf("query = %v, want %v", resp.Query, want)
+	}
+	if got := resp.Headers["X-Custom"]; !reflect.DeepEqual(got, []string{"value"}) {
+		t.Errorf("X-Custom = %v", got)
+	}
+	if got := resp.Headers["Authorization"]; !reflect.DeepEqual(got, []string{"[REDACTED]"}) {
+		t.Errorf("Authorization = %v, want it redacted", got)
+	}
+	if resp.Body != "hello" || resp.Truncated {
+		t.Errorf("body = %q, truncated = %v", resp.Body, resp.Truncated)
+	}
+}
+
+func TestFullEchoTruncatesLargeBodies(t *testing.T) {
+	setConfig(t, nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/echo/full", strings.NewReader(strings.Repeat("x", maxEchoBodyBytes+10)))
+
+	_, body, err := fullEchoHandler(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := body.(FullEchoResponse)
+	if len(resp.Body) != maxEchoBodyBytes || !resp.Truncated {
+		t.Errorf("body length = %d, truncated = %v", len(resp.Body), resp.Truncated)
+	}
+}
+
+func TestEchoBase64(t *testing.T) {
+	setConfig(t, nil)
+	tests := []struct {
+		query   string
+		status  int
+		message string
+	}{
+		{"message=aGVsbG8gd29ybGQ%3D&encoding=base64", http.StatusOK, "hello world"},
+		{"message=aGVsbG8gd29ybGQ&encoding=base64", http.StatusOK, "hello world"},
+		{"message=Pz8_&encoding=base64", http.StatusOK, "???"},
+		{"message=not*base64&encoding=base64", http.StatusBadRequest, ""},
+		{"message=plain&encoding=rot13", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		status, body, err := echoHandler(httptest.NewRequest(http.MethodGet, "/api/echo?"+tt.query, nil))
+		if tt.status != http.StatusOK {
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Status != tt.status {
+				t.Errorf("%s: error = %v, want status %d", tt.query, err, tt.status)
+			}
+			continue
+		}
+		if err != nil || status != tt.status {
+			t.Errorf("%s: got %d, %v", tt.query, status, err)
+			continue
+		}
+		if got := body.(EchoResponse).Message; got != tt.message {
+			t.Errorf("%s: message = %q, want %q", tt.query, got, tt.message)
+		}
+	}
+}
+
+func TestEchoDefaultMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		def        string
+		emptyOK    bool
+		target     string
+		wantStatus int
+		wantMsg    string
+	}{
+		{"default used", "hello from config", false, "/api/echo", http.StatusOK, "hello from config"},
+		{"message wins", "hello from config", false, "/api/echo?message=hi", http.StatusOK, "hi"},
+		{"no default", "", false, "/api/echo", http.StatusBadRequest, ""},
+		{"no default, empty allowed", "", true, "/api/echo", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, func(c *Config) {
+				c.EchoDefault = tt.def
+				c.EchoEmptyOK = tt.emptyOK
+			})
+			status, body, err := echoHandler(httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			var apiErr *APIError
+			if errors.As(err, &apiErr) {
+				status = apiErr.Status
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if err == nil && body.(EchoResponse).Message != tt.wantMsg {
+				t.Errorf("message = %q, want %q", body.(EchoResponse).Message, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestEchoEmptyOKServesEmptyMessage(t *testing.T) {
+	for _, emptyOK := range []bool{false, true} {
+		setConfig(t, func(c *Config) {
+			c.EchoDefault = ""
+			c.EchoEmptyOK = emptyOK
+		})
+		router := newAPIRouter(t)
+
+		rec := serve(router, http.MethodGet, "/api/echo", "")
+		switch {
+		case !emptyOK && rec.Code != http.StatusBadRequest:
+			t.Errorf("ECHO_EMPTY_OK=false: status = %d, want %d", rec.Code, http.StatusBadRequest)
+		case emptyOK && (rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"message":""`)):
+			t.Errorf("ECHO_EMPTY_OK=true: status %d, body %s; want 200 with an empty message", rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestRawEchoMirrorsBody(t *testing.T) {
+	setConfig(t, nil)
+	tests := []struct {
+		contentType, wantType string
+		body                  []byte
+	}{
+		{"application/json", "application/json", []byte(`{"name":"test","value":1}`)},
+		{"text/plain; charset=utf-8", "text/plain; charset=utf-8", []byte("hello, world\n")},
+		{"", "application/octet-stream", []byte{0x00, 0xff, 0x10, 0x80}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/echo/raw", bytes.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		rec := httptest.NewRecorder()
+		rawEchoHandler(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%q: status = %d, want %d", tt.contentType, rec.Code, http.StatusOK)
+		}
+		if got := rec.Header().Get("Content-Type"); got != tt.wantType {
+			t.Errorf("%q: Content-Type = %q, want %q", tt.contentType, got, tt.wantType)
+		}
+		if !bytes.Equal(rec.Body.Bytes(), tt.body) {
+			t.Errorf("%q: body = %q, want %q", tt.contentType, rec.Body.Bytes(), tt.body)
+		}
+	}
+}
+
+func TestRawEchoTooLarge(t *testing.T) {
+	setConfig(t, nil)
+	body := bytes.Repeat([]byte("a"), maxRawEchoBodyBytes+1)
+	rec := httptest.NewRecorder()
+	rawEchoHandler(rec, httptest.NewRequest(http.MethodPost, "/api/echo/raw", bytes.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// FlagStore holds feature flags that can be toggled at runtime
+type FlagStore struct {
+	mu    sync.RWMutex
+	flags map[string]bool
+}
+
+func NewFlagStore(initial map[string]bool) *FlagStore {
+	flags := make(map[string]bool, len(initial))
+	for name, enabled := range initial {
+		flags[name] = enabled
+	}
+	return &FlagStore{flags: flags}
+}
+
+// featureFlags is seeded from FEATURE_FLAGS at startup
+var featureFlags = NewFlagStore(nil)
+
+func (s *FlagStore) Enabled(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.flags[name]
+}
+
+func (s *FlagStore) Set(name string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flags[name] = enabled
+}
+
+// Snapshot returns a copy of all flags
+func (s *FlagStore) Snapshot() map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	flags := make(map[string]bool, len(s.flags))
+	for name, enabled := range s.flags {
+		flags[name] = enabled
+	}
+	return flags
+}
+
+// featureEnabled reports whether a feature flag is on; unknown flags are off
+func featureEnabled(name string) bool {
+	return featureFlags.Enabled(name)
+}
+
+type FlagsResponse struct {
+	Flags     map[string]bool `json:"flags"`
+	Timestamp JSONTime        `json:"timestamp"`
+}
+
+type FlagRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type FlagResponse struct {
+	Success   bool     `json:"success"`
+	Name      string   `json:"name"`
+	Enabled   bool     `json:"enabled"`
+	Timestamp JSONTime `json:"timestamp"`
+}
+
+func listFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, FlagsResponse{
+		Flags:     featureFlags.Snapshot(),
+		Timestamp: nowFunc(),
+	})
+}
+
+func setFlagHandler(w http.ResponseWriter, r *http.Request) {
+	name := pathParam(r, "name")
+
+	var req FlagRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		if requestCancelled(r) {
+			return
+		}
+		writeLocalizedError(w, r, http.StatusBadRequest, "invalid_json")
+		return
+	}
+	if req.Enabled == nil {
+		writeLocalizedError(w, r, http.StatusBadRequest, "missing_field", "enabled")
+		return
+	}
+
+	featureFlags.Set(name, *req.Enabled)
+	log.Printf("Feature flag %q set to %v", name, *req.Enabled)
+
+	writeJSON(w, http.StatusOK, FlagResponse{
+		Success:   true,
+		Name:      name,
+		Enabled:   *req.Enabled,
+		Timestamp: nowFunc(),
+	})
+}
+
+// flagNames returns the configured flag names in sorted order for logging
+func flagNames(flags map[string]bool) []string {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Made with Bob
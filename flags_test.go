@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// setFeatureFlags replaces the flag store for the rest of the test
+func setFeatureFlags(t *testing.T, initial map[string]bool) {
+	t.Helper()
+	saved := featureFlags
+	featureFlags = NewFlagStore(initial)
+	t.Cleanup(func() { featureFlags = saved })
+}
+
+func TestFeatureFlagsSeededFromEnv(t *testing.T) {
+	captureLogs(t)
+	t.Setenv("FEATURE_FLAGS", "new_ui=true, beta_api=false, broken, odd=maybe")
+	c := LoadConfig()
+	setFeatureFlags(t, c.FeatureFlags)
+
+	if !featureEnabled("new_ui") {
+		t.Error("new_ui is off, want on")
+	}
+	for _, name := range []string{"beta_api", "broken", "odd", "never_set"} {
+		if featureEnabled(name) {
+			t.Errorf("%s is on, want off", name)
+		}
+	}
+	if len(c.FeatureFlags) != 2 {
+		t.Errorf("FeatureFlags = %v, want only the well-formed entries", c.FeatureFlags)
+	}
+}
+
+func TestFeatureFlagsAdminEndpoints(t *testing.T) {
+	setConfig(t, nil)
+	setAdmin(t, "secret")
+	captureLogs(t)
+	setFeatureFlags(t, map[string]bool{"new_ui": false})
+
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/admin/flags", adminMiddleware(listFlagsHandler))
+	router.Handle(http.MethodPut, "/admin/flags/{name}", adminMiddleware(setFlagHandler))
+	admin := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(router, http.MethodPut, "/admin/flags/new_ui", `{"enabled":true}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("toggle without a token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := admin(http.MethodPut, "/admin/flags/new_ui", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("toggle without enabled: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := admin(http.MethodPut, "/admin/flags/new_ui", `{"enabled":true}`); rec.Code != http.StatusOK {
+		t.Fatalf("toggle: status = %d: %s", rec.Code, rec.Body)
+	}
+	if !featureEnabled("new_ui") {
+		t.Error("new_ui still off after the toggle")
+	}
+
+	var resp FlagsResponse
+	if err := json.Unmarshal(admin(http.MethodGet, "/admin/flags", "").Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Flags) != 1 || !resp.Flags["new_ui"] {
+		t.Errorf("flags = %v, want new_ui on", resp.Flags)
+	}
+}
+
+// Made with Bob
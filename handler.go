@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// APIHandler is handler logic free of response writing: it returns the
+// status and body to send, or an error, so it can be tested by calling
+// it with a request and inspecting the results. jsonHandler serves it.
+type APIHandler func(r *http.Request) (status int, body interface{}, err error)
+
+// APIError is a client-facing error answered with a localized message
+// from the errorMessages catalog
+type APIError struct {
+	Status int
+	Code   string
+	Args   []any
+}
+
+func (e *APIError) Error() string {
+	message, _ := localize(e.Code, "en", e.Args...)
+	return message
+}
+
+func apiError(status int, code string, args ...any) *APIError {
+	return &APIError{Status: status, Code: code, Args: args}
+}
+
+// errRequestCancelled tells jsonHandler the client has gone away and
+// nothing should be written
+var errRequestCancelled = errors.New("request cancelled by client")
+
+// locator is implemented by bodies that name a resource for the Location header
+type locator interface {
+	Location() string
+}
+
+// jsonHandler adapts an APIHandler to http.HandlerFunc. APIErrors become
+// localized error responses, other errors a 500, and a nil body an empty
+// response with just the status.
+func jsonHandler(h APIHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, body, err := h(r)
+
+		var apiErr *APIError
+		switch {
+		case errors.Is(err, errRequestCancelled):
+		case errors.As(err, &apiErr):
+			if apiErr.Status == http.StatusTooManyRequests || apiErr.Status == http.StatusServiceUnavailable {
+				setRetryAfter(w, cfg.RetryAfter)
+			}
+			writeLocalizedError(w, r, apiErr.Status, apiErr.Code, apiErr.Args...)
+		case err != nil:
+			writeInternalError(w, r, err)
+		case body == nil:
+			w.WriteHeader(status)
+		default:
+			if l, ok := body.(locator); ok && l.Location() != "" {
+				w.Header().Set("Location", l.Location())
+			}
+			writeJSON(w, status, body)
+		}
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// withPathParams sets the path parameters the router would have matched
+func withPathParams(r *http.Request, params map[string]string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), pathParamsKey, params))
+}
+
+// wantAPIError fails unless err is an APIError with the given status and code
+func wantAPIError(t *testing.T, err error, status int, code string) {
+	t.Helper()
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want an APIError", err)
+	}
+	if apiErr.Status != status || apiErr.Code != code {
+		t.Errorf("APIError = %d %s, want %d %s", apiErr.Status, apiErr.Code, status, code)
+	}
+}
+
+func TestEchoHandlerResults(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.EchoDefault = ""
+		c.EchoEmptyOK = false
+	})
+
+	_, _, err := echoHandler(httptest.NewRequest(http.MethodGet, "/api/echo", nil))
+	wantAPIError(t, err, http.StatusBadRequest, "missing_parameter")
+
+	_, _, err = echoHandler(httptest.NewRequest(http.MethodGet, "/api/echo?message=x&encoding=rot13", nil))
+	wantAPIError(t, err, http.StatusBadRequest, "unsupported_encoding")
+
+	status, body, err := echoHandler(httptest.NewRequest(http.MethodGet, "/api/echo?message=hi", nil))
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("echoHandler = %d, %v", status, err)
+	}
+	if got := body.(EchoResponse).Message; got != "hi" {
+		t.Errorf("message = %q, want hi", got)
+	}
+}
+
+func TestDataHandlersResults(t *testing.T) {
+	setConfig(t, func(c *Config) { c.StrictDelete = true })
+	setDataJobs(t, nil)
+	newAPIRouter(t)
+
+	req := withPathParams(httptest.NewRequest(http.MethodGet, "/api/data/a", nil), map[string]string{"name": "a"})
+	_, _, err := getDataHandler(req)
+	wantAPIError(t, err, http.StatusNotFound, "record_not_found")
+
+	_, _, err = dataHandler(httptest.NewRequest(http.MethodPost, "/api/data", strings.NewReader(`{"value":"1"}`)))
+	wantAPIError(t, err, http.StatusBadRequest, "missing_field")
+
+	_, _, err = dataHandler(httptest.NewRequest(http.MethodPost, "/api/data", strings.NewReader(`{`)))
+	wantAPIError(t, err, http.StatusBadRequest, "invalid_json")
+
+	status, body, err := dataHandler(httptest.NewRequest(http.MethodPost, "/api/data", strings.NewReader(`{"name":"a","value":"1"}`)))
+	if err != nil || status != http.StatusCreated {
+		t.Fatalf("dataHandler = %d, %v", status, err)
+	}
+	if got := body.(DataResponse).Data; got.Name != "a" || got.Value != "1" {
+		t.Errorf("created = %+v", got)
+	}
+
+	put := withPathParams(httptest.NewRequest(http.MethodPut, "/api/data/a", strings.NewReader(`{"name":"b"}`)), map[string]string{"name": "a"})
+	_, _, err = putDataHandler(put)
+	wantAPIError(t, err, http.StatusBadRequest, "record_name_immutable")
+
+	status, body, err = getDataHandler(req)
+	if err != nil || status != http.StatusOK || body.(DataResponse).Data.Value != "1" {
+		t.Errorf("getDataHandler = %d, %+v, %v", status, body, err)
+	}
+
+	del := withPathParams(httptest.NewRequest(http.MethodDelete, "/api/data/a", nil), map[string]string{"name": "a"})
+	if status, body, err := deleteDataHandler(del); err != nil || status != http.StatusNoContent || body != nil {
+		t.Errorf("deleteDataHandler = %d, %v, %v; want 204 with no body", status, body, err)
+	}
+	_, _, err = deleteDataHandler(del)
+	wantAPIError(t, err, http.StatusNotFound, "record_not_found")
+}
+
+func TestJSONHandlerSerializesResults(t *testing.T) {
+	setConfig(t, nil)
+	captureLogs(t)
+	tests := []struct {
+		name   string
+		h      APIHandler
+		status int
+		body   string
+	}{
+		{"api error", func(r *http.Request) (int, interface{}, error) {
+			return 0, nil, apiError(http.StatusNotFound, "record_not_found")
+		}, http.StatusNotFound, `"code":"record_not_found"`},
+		{"internal error", func(r *http.Request) (int, interface{}, error) {
+			return 0, nil, errors.New("disk on fire")
+		}, http.StatusInternalServerError, `"error"`},
+		{"no body", func(r *http.Request) (int, interface{}, error) {
+			return http.StatusNoContent, nil, nil
+		}, http.StatusNoContent, ""},
+		{"body", func(r *http.Request) (int, interface{}, error) {
+			return http.StatusOK, EchoResponse{Message: "hi"}, nil
+		}, http.StatusOK, `"message":"hi"`},
+	}
+	for _, tt := range tests {
+		rec := serve(jsonHandler(tt.h), http.MethodGet, "/", "")
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if got := rec.Body.String(); (tt.body == "" && got != "") || !strings.Contains(got, tt.body) {
+			t.Errorf("%s: body = %q, want %s", tt.name, got, tt.body)
+		}
+	}
+	if rec := serve(jsonHandler(tests[1].h), http.MethodGet, "/", ""); strings.Contains(rec.Body.String(), "disk on fire") {
+		t.Errorf("internal error leaked to the client: %s", rec.Body)
+	}
+}
+
+// Made with Bob
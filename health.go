@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Maximum time a single readiness check may take
+const readinessCheckTimeout = 3 * time.Second
+
+// HealthCheck is a named probe evaluated by the readiness endpoint. Checks
+// registered with HEALTH_CACHE_TTL keep their result in cache.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+	cache *checkCache
+}
+
+var readinessChecks []HealthCheck
+
+// probePaths keep working while the server is warming up or in maintenance,
+// so probes and scrapes still see the instance
+var probePaths = map[string]bool{
+	"/health":         true,
+	"/health/summary": true,
+	"/readiness":      true,
+	"/metrics":        true,
+}
+
+// registerReadinessCheck adds a deep check to /readiness and /health/summary,
+// caching its result for HEALTH_CACHE_TTL when set
+func registerReadinessCheck(name string, check func(ctx context.Context) error) {
+	hc := HealthCheck{Name: name, Check: check}
+	if cfg.HealthCacheTTL > 0 {
+		hc.cache = &checkCache{check: check, ttl: cfg.HealthCacheTTL}
+		hc.Check = hc.cache.Check
+	}
+	readinessChecks = append(readinessChecks, hc)
+}
+
+// registerStateCheck adds a readiness check of in-process state, such as an
+// injected fault, which is cheap and must take effect at once, so it is
+// never cached
+func registerStateCheck(name string, check func(ctx context.Context) error) {
+	readinessChecks = append(readinessChecks, HealthCheck{Name: name, Check: check})
+}
+
+// checkCache reuses a check's last result for ttl, so aggressive probing
+// does not re-run it against the dependency each time
+type checkCache struct {
+	check func(ctx context.Context) error
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	lastRun time.Time
+	latency time.Duration
+	lastErr error
+}
+
+// Run returns the last result while it is fresh, or runs the check, along
+// with when that result was produced and how long the check took. A run cut
+// short by ctx says nothing about the dependency, so it is not cached.
+func (c *checkCache) Run(ctx context.Context) (time.Time, time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.lastRun.IsZero() && clock.Since(c.lastRun) < c.ttl {
+		return c.lastRun, c.latency, c.lastErr
+	}
+
+	start := clock.Now()
+	err := c.check(ctx)
+	latency := clock.Since(start)
+	if ctx.Err() == nil {
+		c.lastRun, c.latency, c.lastErr = start, latency, err
+	}
+	return start, latency, err
+}
+
+// Check runs the check through the cache
+func (c *checkCache) Check(ctx context.Context) error {
+	_, _, err := c.Run(ctx)
+	return err
+}
+
+type ReadinessResponse struct {
+	Status    string            `json:"status"`
+	Checks    map[string]string `json:"checks"`
+	Timestamp JSONTime          `json:"timestamp"`
+}
+
+// readinessHandler reports whether the instance should receive traffic
+func readinessHandler(w http.ResponseWriter, r *http.Request) {
+	response := ReadinessResponse{
+		Status:    "ready",
+		Checks:    make(map[string]string, len(readinessChecks)),
+		Timestamp: nowFunc(),
+	}
+
+	if !startupComplete.Load() {
+		response.Status = "not_ready"
+		response.Checks["startup"] = "server is warming up"
+	}
+	if shuttingDown.Load() {
+		response.Status = "not_ready"
+		response.Checks["shutdown"] = "server is shutting down"
+	}
+	if maintenanceMode.Load() && cfg.MaintenanceFailReadiness {
+		response.Status = "not_ready"
+		response.Checks["maintenance"] = "maintenance mode is on"
+	}
+
+	for _, hc := range readinessChecks {
+		result := runCheck(r.Context(), "readiness", hc)
+		if result.Status != "ok" {
+			response.Status = "not_ready"
+			response.Checks[hc.Name] = result.Error
+			continue
+		}
+		response.Checks[hc.Name] = "ok"
+	}
+
+	if response.Status != "ready" {
+		writeJSON(w, http.StatusServiceUnavailable, response)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// CheckResult is the outcome of one check in the health summary
+type CheckResult struct {
+	Name    string   `json:"name"`
+	Kind    string   `json:"kind"`
+	Status  string   `json:"status"`
+	Error   string   `json:"error,omitempty"`
+	LastRun JSONTime `json:"last_run"`
+	Latency string   `json:"latency"`
+}
+
+type HealthSummaryResponse struct {
+	Status    string        `json:"status"`
+	Checks    []CheckResult `json:"checks"`
+	Timestamp JSONTime      `json:"timestamp"`
+}
+
+// runCheck runs hc with the per-check timeout and times it. A cached
+// result reports when and how long the check actually ran.
+func runCheck(ctx context.Context, kind string, hc HealthCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	var lastRun time.Time
+	var latency time.Duration
+	var err error
+	if hc.cache != nil {
+		lastRun, latency, err = hc.cache.Run(ctx)
+	} else {
+		lastRun = clock.Now()
+		err = hc.Check(ctx)
+		latency = clock.Since(lastRun)
+	}
+	result := CheckResult{
+		Name:    hc.Name,
+		Kind:    kind,
+		Status:  "ok",
+		LastRun: responseTime(lastRun),
+		Latency: latency.String(),
+	}
+	if err != nil {
+		result.Status = "failing"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// stateCheck turns a server state flag into a check for the summary
+func stateCheck(name string, failing func() bool, message string) HealthCheck {
+	return HealthCheck{Name: name, Check: func(ctx context.Context) error {
+		if failing() {
+			return errors.New(message)
+		}
+		return nil
+	}}
+}
+
+// healthSummary runs every liveness and readiness check and reports each
+// result; the overall status is failing if any check fails
+func healthSummary(ctx context.Context) HealthSummaryResponse {
+	liveness := []HealthCheck{
+		stateCheck("shutdown", shuttingDown.Load, "server is shutting down"),
+	}
+	readiness := append([]HealthCheck{
+		stateCheck("startup", func() bool { return !startupComplete.Load() }, "server is warming up"),
+		stateCheck("shutdown", shuttingDown.Load, "server is shutting down"),
+		stateCheck("maintenance", func() bool {
+			return maintenanceMode.Load() && cfg.MaintenanceFailReadiness
+		}, "maintenance mode is on"),
+	}, readinessChecks...)
+
+	response := HealthSummaryResponse{
+		Status:    "ok",
+		Checks:    make([]CheckResult, 0, len(liveness)+len(readiness)),
+		Timestamp: nowFunc(),
+	}
+	for _, hc := range liveness {
+		response.Checks = append(response.Checks, runCheck(ctx, "liveness", hc))
+	}
+	for _, hc := range readiness {
+		response.Checks = append(response.Checks, runCheck(ctx, "readiness", hc))
+	}
+	for _, result := range response.Checks {
+		if result.Status != "ok" {
+			response.Status = "failing"
+		}
+	}
+	return response
+}
+
+func healthSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	response := healthSummary(r.Context())
+	if response.Status != "ok" {
+		writeJSON(w, http.StatusServiceUnavailable, response)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// workDirCheck verifies that dir is writable by creating and removing a small file
+func workDirCheck(dir string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		f, err := os.CreateTemp(dir, ".readiness-*")
+		if err != nil {
+			return fmt.Errorf("work dir not writable: %w", err)
+		}
+		name := f.Name()
+		defer os.Remove(name)
+
+		if _, err := f.Write([]byte("ok")); err != nil {
+			f.Close()
+			return fmt.Errorf("work dir write failed: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("work dir write failed: %w", err)
+		}
+		if err := os.Remove(name); err != nil {
+			return fmt.Errorf("work dir cleanup failed: %w", err)
+		}
+		return nil
+	}
+}
+
+// checkClient is shared by all HTTP dependency checks, so repeated probes
+// reuse pooled connections instead of dialing (and leaking FDs) each time
+var checkClient = http.DefaultClient
+
+// newCheckClient builds the client for HTTP dependency checks. Each check
+// is bounded by its context; the timeouts here cover connection setup.
+func newCheckClient(c Config) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         (&net.Dialer{Timeout: c.CheckHTTPTimeout, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout: c.CheckHTTPTimeout,
+			MaxIdleConns:        c.CheckMaxIdleConns,
+			MaxIdleConnsPerHost: c.CheckMaxIdleConns,
+			IdleConnTimeout:     c.CheckIdleConnTimeout,
+		},
+	}
+}
+
+// httpCheck passes when a GET of url answers with a status below 400
+func httpCheck(url string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := checkClient.Do(req)
+		if err != nil {
+			return err
+		}
+		// Drain a little of the body so the connection can go back to the pool
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+		resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// Made with Bob
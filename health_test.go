@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkDirCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	if err := workDirCheck(dir)(context.Background()); err != nil {
+		t.Fatalf("writable dir failed: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("check left %d files behind", len(entries))
+	}
+}
+
+func TestWorkDirCheckReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0o755) })
+
+	if err := workDirCheck(dir)(context.Background()); err == nil {
+		t.Error("read-only dir passed the check")
+	}
+}
+
+func TestWorkDirCheckMissing(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	if err := workDirCheck(dir)(context.Background()); err == nil {
+		t.Error("missing dir passed the check")
+	}
+}
+
+func TestHealthSummaryAggregatesChecks(t *testing.T) {
+	setConfig(t, nil)
+	setMaintenance(t, false)
+	passing := HealthCheck{Name: "cache", Check: func(ctx context.Context) error { return nil }}
+	failing := HealthCheck{Name: "database", Check: func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}}
+
+	setReadiness(t, passing)
+	if rec := serve(http.HandlerFunc(healthSummaryHandler), http.MethodGet, "/health/summary", ""); rec.Code != http.StatusOK {
+		t.Errorf("all passing: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	setReadiness(t, passing, failing)
+	rec := serve(http.HandlerFunc(healthSummaryHandler), http.MethodGet, "/health/summary", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("one failing: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	var resp HealthSummaryResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "failing" {
+		t.Errorf("overall status = %q, want failing", resp.Status)
+	}
+
+	results := make(map[string]CheckResult)
+	for _, result := range resp.Checks {
+		results[result.Kind+"/"+result.Name] = result
+	}
+	if got := results["readiness/cache"]; got.Status != "ok" || got.Latency == "" || got.LastRun.IsZero() {
+		t.Errorf("cache result = %+v", got)
+	}
+	if got := results["readiness/database"]; got.Status != "failing" || got.Error != "connection refused" {
+		t.Errorf("database result = %+v", got)
+	}
+	if _, ok := results["liveness/shutdown"]; !ok {
+		t.Errorf("no liveness checks in %+v", resp.Checks)
+	}
+}
+
+func TestHealthCacheTTL(t *testing.T) {
+	tests := []struct {
+		ttl       time.Duration
+		wantCalls int
+	}{
+		{10 * time.Second, 1},
+		{0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ttl.String(), func(t *testing.T) {
+			setConfig(t, func(c *Config) { c.HealthCacheTTL = tt.ttl })
+			setMaintenance(t, false)
+			fake := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			setClock(t, fake)
+			setReadiness(t)
+
+			calls := 0
+			registerReadinessCheck("database", func(ctx context.Context) error {
+				calls++
+				return nil
+			})
+
+			for i := 0; i < 3; i++ {
+				serve(http.HandlerFunc(readinessHandler), http.MethodGet, "/readiness", "")
+				fake.Advance(time.Second)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("check ran %d times in 3 probes, want %d", calls, tt.wantCalls)
+			}
+
+			fake.Advance(tt.ttl)
+			serve(http.HandlerFunc(readinessHandler), http.MethodGet, "/readiness", "")
+			if calls != tt.wantCalls+1 {
+				t.Errorf("check ran %d times after the TTL, want %d", calls, tt.wantCalls+1)
+			}
+		})
+	}
+}
+
+func TestCachedCheckReportsActualRun(t *testing.T) {
+	setConfig(t, func(c *Config) { c.HealthCacheTTL = time.Minute })
+	fake := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	setClock(t, fake)
+	setReadiness(t)
+
+	registerReadinessCheck("database", func(ctx context.Context) error {
+		fake.Advance(250 * time.Millisecond)
+		return nil
+	})
+	hc := readinessChecks[0]
+
+	first := runCheck(context.Background(), "readiness", hc)
+	fake.Advance(10 * time.Second)
+	cached := runCheck(context.Background(), "readiness", hc)
+	if !cached.LastRun.Equal(first.LastRun.Time) || cached.Latency != "250ms" {
+		t.Errorf("cached result ran at %v in %s, want the real run at %v in 250ms", cached.LastRun, cached.Latency, first.LastRun)
+	}
+}
+
+func TestCachedCheckSkipsCancelledRuns(t *testing.T) {
+	setConfig(t, func(c *Config) { c.HealthCacheTTL = time.Minute })
+	setClock(t, newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+	setReadiness(t)
+
+	calls := 0
+	registerReadinessCheck("database", func(ctx context.Context) error {
+		calls++
+		return ctx.Err()
+	})
+	hc := readinessChecks[0]
+
+	aborted, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result := runCheck(aborted, "readiness", hc); result.Status != "failing" {
+		t.Errorf("aborted probe status = %q, want failing", result.Status)
+	}
+	if result := runCheck(context.Background(), "readiness", hc); result.Status != "ok" || calls != 2 {
+		t.Errorf("next probe: status %q after %d runs, want the check re-run and ok", result.Status, calls)
+	}
+}
+
+func TestHTTPChecksReuseSharedClient(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.CheckHTTPTimeout = time.Second
+		c.CheckMaxIdleConns = 2
+		c.CheckIdleConnTimeout = time.Minute
+	})
+	saved := checkClient
+	checkClient = newCheckClient(cfg)
+	t.Cleanup(func() { checkClient = saved })
+
+	var dials atomic.Int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(okHandler))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	database, cache := httpCheck(ts.URL+"/db"), httpCheck(ts.URL+"/cache")
+	for i := 0; i < 5; i++ {
+		for _, check := range []func(ctx context.Context) error{database, cache} {
+			if err := check(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if got := dials.Load(); got != 1 {
+		t.Errorf("10 checks opened %d connections, want 1 reused from the shared pool", got)
+	}
+
+	transport := checkClient.Transport.(*http.Transport)
+	if transport.MaxIdleConnsPerHost != 2 || transport.IdleConnTimeout != time.Minute {
+		t.Errorf("transport pool = %d idle per host, %v idle timeout; want the configured 2 and 1m",
+			transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+}
+
+// Made with Bob
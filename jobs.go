@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Job states
+const (
+	jobQueued     = "queued"
+	jobProcessing = "processing"
+	jobDone       = "done"
+)
+
+var errQueueFull = errors.New("job queue is full")
+
+// Job tracks an asynchronously processed data record
+type Job struct {
+	ID          string      `json:"id"`
+	Status      string      `json:"status"`
+	Data        DataRequest `json:"data"`
+	CreatedAt   JSONTime    `json:"created_at"`
+	CompletedAt *JSONTime   `json:"completed_at,omitempty"`
+}
+
+type JobResponse struct {
+	Success   bool     `json:"success"`
+	Job       Job      `json:"job"`
+	Timestamp JSONTime `json:"timestamp"`
+
+	prefix string // route group the job was requested through, e.g. "/v1"
+}
+
+// jobQueue is a bounded queue of data jobs served by a fixed pool of workers.
+// Finished jobs are kept for retention, then forgotten.
+type jobQueue struct {
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	finished  []finishedJob // oldest first
+	retention time.Duration
+	queue     chan *Job
+	closed    bool
+}
+
+// finishedJob records when a job finished, for eviction
+type finishedJob struct {
+	id string
+	at time.Time
+}
+
+// dataJobs is nil unless ASYNC_DATA is enabled
+var dataJobs *jobQueue
+
+// newJobQueue starts workers goroutines draining a queue of the given depth,
+// keeping finished jobs for retention. Workers are tracked by
+// backgroundWorkers so shutdown waits for queued jobs.
+func newJobQueue(workers, depth int, retention time.Duration) *jobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	if depth < 0 {
+		depth = 0
+	}
+
+	q := &jobQueue{
+		jobs:      make(map[string]*Job),
+		retention: retention,
+		queue:     make(chan *Job, depth),
+	}
+	for i := 0; i < workers; i++ {
+		backgroundWorkers.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Enqueue records a job for rec and queues it, failing with errQueueFull
+// instead of blocking when the queue has no room
+func (q *jobQueue) Enqueue(rec DataRequest) (Job, error) {
+	job := &Job{
+		ID:        randomHex(8),
+		Status:    jobQueued,
+		Data:      rec,
+		CreatedAt: nowFunc(),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Job{}, errQueueFull
+	}
+	q.evict(clock.Now())
+	select {
+	case q.queue <- job:
+	default:
+		return Job{}, errQueueFull
+	}
+	q.jobs[job.ID] = job
+	return *job, nil
+}
+
+// Get returns a snapshot of the job with the given ID
+func (q *jobQueue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.evict(clock.Now())
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// evict forgets jobs that finished more than retention ago. Jobs finish in
+// order, so only the front of finished needs checking.
+func (q *jobQueue) evict(now time.Time) {
+	n := 0
+	for n < len(q.finished) && now.Sub(q.finished[n].at) >= q.retention {
+		delete(q.jobs, q.finished[n].id)
+		n++
+	}
+	q.finished = q.finished[n:]
+}
+
+// Close stops accepting jobs; workers exit once the queue is drained
+func (q *jobQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+}
+
+func (q *jobQueue) work() {
+	defer backgroundWorkers.Done()
+	for job := range q.queue {
+		q.setStatus(job, jobProcessing)
+		dataStore.Put(job.Data)
+		q.setStatus(job, jobDone)
+	}
+}
+
+func (q *jobQueue) setStatus(job *Job, status string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job.Status = status
+	if status == jobDone {
+		now := nowFunc()
+		job.CompletedAt = &now
+		q.finished = append(q.finished, finishedJob{id: job.ID, at: clock.Now()})
+		q.evict(clock.Now())
+	}
+}
+
+// Location points clients at the job's status endpoint, in the same API
+// version as the request
+func (resp JobResponse) Location() string {
+	return resp.prefix + "/api/data/jobs/" + resp.Job.ID
+}
+
+// enqueueDataHandler answers POST /api/data in async mode with 202 and the job
+func enqueueDataHandler(r *http.Request, req DataRequest) (int, interface{}, error) {
+	job, err := dataJobs.Enqueue(req)
+	if err != nil {
+		log.Printf("Rejecting data job: %v", err)
+		return 0, nil, apiError(http.StatusServiceUnavailable, "queue_full")
+	}
+
+	return http.StatusAccepted, JobResponse{
+		Success:   true,
+		Job:       job,
+		Timestamp: nowFunc(),
+		prefix:    routePrefix(r),
+	}, nil
+}
+
+func getJobHandler(r *http.Request) (int, interface{}, error) {
+	job, ok := dataJobs.Get(pathParam(r, "id"))
+	if !ok {
+		return 0, nil, apiError(http.StatusNotFound, "job_not_found")
+	}
+
+	return http.StatusOK, JobResponse{
+		Success:   true,
+		Job:       job,
+		Timestamp: nowFunc(),
+		prefix:    routePrefix(r),
+	}, nil
+}
+
+// Made with Bob
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// setDataJobs enables async data processing with q for the rest of the test
+func setDataJobs(t *testing.T, q *jobQueue) {
+	t.Helper()
+	saved := dataJobs
+	dataJobs = q
+	t.Cleanup(func() { dataJobs = saved })
+}
+
+// idleJobQueue is a queue with no workers, so jobs stay queued until the
+// test finishes them
+func idleJobQueue(depth int, retention time.Duration) *jobQueue {
+	return &jobQueue{
+		jobs:      make(map[string]*Job),
+		retention: retention,
+		queue:     make(chan *Job, depth),
+	}
+}
+
+func decodeJob(t *testing.T, body []byte) Job {
+	t.Helper()
+	var resp JobResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	return resp.Job
+}
+
+func TestAsyncDataEnqueueAndPoll(t *testing.T) {
+	setConfig(t, nil)
+	q := newJobQueue(1, 4, time.Minute)
+	t.Cleanup(q.Close)
+	setDataJobs(t, q)
+	router := newAPIRouter(t)
+
+	rec := serve(router, http.MethodPost, "/api/data", `{"name":"async","value":"later"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+	}
+	job := decodeJob(t, rec.Body.Bytes())
+	if job.ID == "" {
+		t.Fatal("no job ID")
+	}
+	if got, want := rec.Header().Get("Location"), "/api/data/jobs/"+job.ID; got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != jobDone {
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s after 5s", job.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+		rec := serve(router, http.MethodGet, "/api/data/jobs/"+job.ID, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("poll status = %d: %s", rec.Code, rec.Body)
+		}
+		job = decodeJob(t, rec.Body.Bytes())
+	}
+	if job.CompletedAt == nil {
+		t.Error("done job has no completed_at")
+	}
+	if got, ok := dataStore.Get("async"); !ok || got.Value != "later" {
+		t.Errorf("stored record = %+v, %v", got, ok)
+	}
+
+	if rec := serve(router, http.MethodGet, "/api/data/jobs/unknown", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAsyncDataQueueFull(t *testing.T) {
+	setConfig(t, nil)
+	captureLogs(t)
+	setDataJobs(t, idleJobQueue(1, time.Minute))
+	router := newAPIRouter(t)
+
+	if rec := serve(router, http.MethodPost, "/api/data", `{"name":"first"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("first: status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	rec := serve(router, http.MethodPost, "/api/data", `{"name":"second"}`)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("queue full: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("queue full: no Retry-After")
+	}
+}
+
+func TestFinishedJobsEvicted(t *testing.T) {
+	fake := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	setClock(t, fake)
+	q := idleJobQueue(2, time.Minute)
+
+	job, err := q.Enqueue(DataRequest{Name: "kept"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.setStatus(q.jobs[job.ID], jobDone)
+
+	fake.Advance(30 * time.Second)
+	if _, ok := q.Get(job.ID); !ok {
+		t.Fatal("job forgotten within its retention")
+	}
+	fake.Advance(30 * time.Second)
+	if _, ok := q.Get(job.ID); ok {
+		t.Error("job kept past its retention")
+	}
+}
+
+func TestAsyncDataLocationKeepsVersion(t *testing.T) {
+	setConfig(t, nil)
+	setDataJobs(t, idleJobQueue(4, time.Minute))
+	router := newAPIRouter(t)
+	for _, v := range apiVersions {
+		router.Group(v.prefix, func(g *RouteGroup) { v.register(g) })
+	}
+
+	for _, prefix := range []string{"", "/v1", "/v2"} {
+		rec := serve(router, http.MethodPost, prefix+"/api/data", `{"name":"async"}`)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("%s: status = %d: %s", prefix, rec.Code, rec.Body)
+		}
+		job := decodeJob(t, rec.Body.Bytes())
+		location := rec.Header().Get("Location")
+		if want := prefix + "/api/data/jobs/" + job.ID; location != want {
+			t.Errorf("Location = %q, want %q", location, want)
+		}
+		if rec := serve(router, http.MethodGet, location, ""); rec.Code != http.StatusOK || rec.Header().Get("Location") != location {
+			t.Errorf("polling %s: %d, Location %q", location, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
+
+// Made with Bob
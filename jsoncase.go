@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Response structs tag multi-word fields in snake_case (e.g. request_id).
+// With JSON_FIELD_CASE=camel the names are rewritten to camelCase on output.
+// Only struct field names are converted; map keys such as header names
+// or query parameters are user data and are left untouched.
+//
+// Optional fields are tagged omitempty and left out when zero. With
+// OMIT_EMPTY_FIELDS=false they are always emitted, as zero values or null.
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// applyFieldCase converts v into a generic value whose struct field names
+// and optional fields follow the configured conventions
+func applyFieldCase(v interface{}) interface{} {
+	if !camelCaseFields() && cfg.OmitEmptyFields {
+		return v
+	}
+	return convertFieldCase(reflect.ValueOf(v))
+}
+
+func convertFieldCase(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return convertFieldCase(v.Elem())
+	case reflect.Struct:
+		out := make(map[string]interface{}, v.NumField())
+		convertStructFields(v, out)
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[mapKeyString(iter.Key())] = convertFieldCase(iter.Value())
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = convertFieldCase(v.Index(i))
+		}
+		return out
+	default:
+		return v.Interface()
+	}
+}
+
+func convertStructFields(v reflect.Value, out map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			convertStructFields(v.Field(i), out)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fv := v.Field(i)
+		if cfg.OmitEmptyFields && strings.Contains(opts, "omitempty") && fv.IsZero() {
+			continue
+		}
+		if camelCaseFields() {
+			name = snakeToCamel(name)
+		}
+		out[name] = convertFieldCase(fv)
+	}
+}
+
+func mapKeyString(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	b, _ := json.Marshal(k.Interface())
+	return strings.Trim(string(b), `"`)
+}
+
+func camelCaseFields() bool {
+	return strings.ToLower(cfg.JSONFieldCase) == "camel"
+}
+
+// snakeToCamel turns request_id into requestId
+func snakeToCamel(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// Made with Bob
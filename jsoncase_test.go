@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONFieldCase(t *testing.T) {
+	body := ReplayResult{Method: "GET", Path: "/", OriginalStatus: 200}
+	tests := []struct {
+		fieldCase string
+		want      string
+		unwanted  string
+	}{
+		{"snake", `"original_status":200`, `"originalStatus"`},
+		{"camel", `"originalStatus":200`, `"original_status"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fieldCase, func(t *testing.T) {
+			setConfig(t, func(c *Config) { c.JSONFieldCase = tt.fieldCase })
+
+			rec := httptest.NewRecorder()
+			writeJSON(rec, http.StatusOK, body)
+			if got := rec.Body.String(); !strings.Contains(got, tt.want) || strings.Contains(got, tt.unwanted) {
+				t.Errorf("body = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONFieldCaseLeavesMapKeys(t *testing.T) {
+	setConfig(t, func(c *Config) { c.JSONFieldCase = "camel" })
+
+	rec := httptest.NewRecorder()
+	writeJSON(rec, http.StatusOK, FullEchoResponse{Headers: map[string][]string{"x_custom_header": {"v"}}})
+	if got := rec.Body.String(); !strings.Contains(got, `"x_custom_header"`) {
+		t.Errorf("map key was renamed: %s", got)
+	}
+}
+
+func TestOmitEmptyFields(t *testing.T) {
+	body := ErrorResponse{Error: "Not found"}
+	tests := []struct {
+		name      string
+		omit      bool
+		fieldCase string
+		present   bool
+	}{
+		{"omitted", true, "snake", false},
+		{"emitted", false, "snake", true},
+		{"emitted camel", false, "camel", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, func(c *Config) {
+				c.OmitEmptyFields = tt.omit
+				c.JSONFieldCase = tt.fieldCase
+			})
+
+			rec := httptest.NewRecorder()
+			writeJSON(rec, http.StatusNotFound, body)
+			got := rec.Body.String()
+			for _, field := range []string{`"code"`, `"detail"`} {
+				if strings.Contains(got, field) != tt.present {
+					t.Errorf("body = %s, want %s present: %v", got, field, tt.present)
+				}
+			}
+			if !strings.Contains(got, `"error":"Not found"`) {
+				t.Errorf("body = %s, want the required error field", got)
+			}
+		})
+	}
+}
+
+func TestSnakeToCamel(t *testing.T) {
+	tests := map[string]string{
+		"request_id":     "requestId",
+		"name":           "name",
+		"in_flight_at_x": "inFlightAtX",
+	}
+	for in, want := range tests {
+		if got := snakeToCamel(in); got != want {
+			t.Errorf("snakeToCamel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const languageKey contextKey = "language"
+
+// languageMiddleware picks the best supported language for the request's
+// Accept-Language header and stores it in the request context
+func languageMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := negotiateLanguage(r.Header.Get("Accept-Language"), cfg.SupportedLanguages, cfg.DefaultLanguage)
+		next(w, r.WithContext(context.WithValue(r.Context(), languageKey, lang)))
+	}
+}
+
+// languageFromContext returns the negotiated language, or DEFAULT_LANGUAGE
+func languageFromContext(ctx context.Context) string {
+	if lang, ok := ctx.Value(languageKey).(string); ok {
+		return lang
+	}
+	return cfg.DefaultLanguage
+}
+
+type languageRange struct {
+	tag string
+	q   float64
+}
+
+// negotiateLanguage returns the supported language best matching header.
+// Ranges are tried in q-value order; each matches a supported tag exactly
+// or by primary subtag ("fr-CH" matches "fr"), and "*" matches the fallback.
+func negotiateLanguage(header string, supported []string, fallback string) string {
+	var ranges []languageRange
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			ranges = append(ranges, languageRange{tag: tag, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, lr := range ranges {
+		if lr.tag == "*" {
+			return fallback
+		}
+		for _, lang := range supported {
+			if strings.EqualFold(lang, lr.tag) {
+				return lang
+			}
+		}
+		primary, _, _ := strings.Cut(lr.tag, "-")
+		for _, lang := range supported {
+			if strings.EqualFold(lang, primary) {
+				return lang
+			}
+		}
+	}
+	return fallback
+}
+
+// Made with Bob
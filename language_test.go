@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateLanguage(t *testing.T) {
+	supported := []string{"en", "fr", "pt-BR"}
+	tests := map[string]string{
+		"":                          "en",
+		"fr":                        "fr",
+		"fr-CH, fr;q=0.9, en;q=0.8": "fr",
+		"de, fr;q=0.5":              "fr",
+		"en;q=0.2, fr;q=0.7":        "fr",
+		"pt-br":                     "pt-BR",
+		"de, ja":                    "en",
+		"fr;q=0, de":                "en",
+		"*":                         "en",
+		"fr;q=abc, en":              "en",
+	}
+	for header, want := range tests {
+		if got := negotiateLanguage(header, supported, "en"); got != want {
+			t.Errorf("Accept-Language %q = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestLanguageMiddlewareStoresLanguage(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.SupportedLanguages = []string{"en", "fr"}
+		c.DefaultLanguage = "en"
+	})
+
+	var got string
+	handler := languageMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		got = languageFromContext(r.Context())
+	})
+	handler(httptest.NewRecorder(), newRequestWithHeader(http.MethodGet, "/", "Accept-Language", "fr-FR,fr;q=0.9"))
+	if got != "fr" {
+		t.Errorf("language = %q, want fr", got)
+	}
+
+	handler(httptest.NewRecorder(), newRequestWithHeader(http.MethodGet, "/", "", ""))
+	if got != "en" {
+		t.Errorf("language without a header = %q, want the default en", got)
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requestLimitsMiddleware rejects requests with overly long paths, too many
+// query parameters or header fields, or oversized bodies, guarding against abuse
+func requestLimitsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.MaxPathLength > 0 && len(r.URL.EscapedPath()) > cfg.MaxPathLength {
+			writeLocalizedError(w, r, http.StatusRequestURITooLong, "path_too_long", cfg.MaxPathLength)
+			return
+		}
+
+		if cfg.MaxQueryParams > 0 && countQueryParams(r.URL.RawQuery) > cfg.MaxQueryParams {
+			writeLocalizedError(w, r, http.StatusBadRequest, "too_many_query_params", cfg.MaxQueryParams)
+			return
+		}
+
+		if cfg.MaxHeaders > 0 && countHeaders(r.Header) > cfg.MaxHeaders {
+			writeLocalizedError(w, r, http.StatusBadRequest, "too_many_headers", cfg.MaxHeaders)
+			return
+		}
+
+		// Checking the declared length before reading means a client sending
+		// Expect: 100-continue gets 413 instead of 100 and never sends the body
+		if cfg.MaxBodyBytes > 0 {
+			if r.ContentLength > int64(cfg.MaxBodyBytes) {
+				w.Header().Set("Connection", "close")
+				writeLocalizedError(w, r, http.StatusRequestEntityTooLarge, "body_too_large", cfg.MaxBodyBytes)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, int64(cfg.MaxBodyBytes))
+		}
+
+		next(w, r)
+	}
+}
+
+// concurrencyLimit caps how many requests the routes sharing it handle at
+// once; a nil limit allows any number
+type concurrencyLimit chan struct{}
+
+// uploadSlots limits the routes that buffer uploaded bodies, per
+// MAX_CONCURRENT_UPLOADS, so they cannot exhaust memory together
+var uploadSlots concurrencyLimit
+
+func newConcurrencyLimit(n int) concurrencyLimit {
+	if n <= 0 {
+		return nil
+	}
+	return make(concurrencyLimit, n)
+}
+
+// middleware answers 503 with Retry-After when every slot is taken instead
+// of queueing, so excess requests do not hold memory while they wait
+func (l concurrencyLimit) middleware(next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case l <- struct{}{}:
+		default:
+			setRetryAfter(w, cfg.RetryAfter)
+			writeLocalizedError(w, r, http.StatusServiceUnavailable, "too_many_uploads")
+			return
+		}
+		defer func() { <-l }()
+		next(w, r)
+	}
+}
+
+// readTimeoutFor returns the time allowed to read a request whose body is
+// contentLength bytes: READ_TIMEOUT plus the time the body takes at
+// READ_TIMEOUT_BYTES_PER_SEC, capped at READ_TIMEOUT_MAX. Unknown lengths
+// get READ_TIMEOUT.
+func readTimeoutFor(contentLength int64) time.Duration {
+	if cfg.ReadTimeoutBytesPerSec <= 0 || contentLength <= 0 {
+		return cfg.ReadTimeout
+	}
+	timeout := cfg.ReadTimeout + time.Duration(float64(contentLength)/float64(cfg.ReadTimeoutBytesPerSec)*float64(time.Second))
+	if timeout > cfg.ReadTimeoutMax {
+		timeout = max(cfg.ReadTimeoutMax, cfg.ReadTimeout)
+	}
+	return timeout
+}
+
+// readTimeoutMiddleware extends the read deadline of requests with large
+// declared bodies, so honest uploads are not cut off by READ_TIMEOUT while
+// slow clients sending little still are. The write deadline moves with it,
+// as the server starts that clock once the headers are read.
+func readTimeoutMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if cfg.ReadTimeoutBytesPerSec <= 0 || cfg.ReadTimeout <= 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		timeout := readTimeoutFor(r.ContentLength)
+		if timeout > cfg.ReadTimeout {
+			now := time.Now()
+			rc := http.NewResponseController(w)
+			if err := rc.SetReadDeadline(now.Add(timeout)); err != nil {
+				slog.Debug("Could not extend read deadline", "error", err)
+			} else if cfg.WriteTimeout > 0 {
+				rc.SetWriteDeadline(now.Add(timeout + cfg.WriteTimeout))
+			}
+		}
+		next(w, r)
+	}
+}
+
+// charsetMiddleware answers requests whose Content-Type names a charset
+// outside ACCEPTED_CHARSETS with 415, when CHECK_REQUEST_CHARSET is set.
+// A Content-Type without a charset is taken to be UTF-8.
+func charsetMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if !cfg.CheckRequestCharset {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if charset := strings.ToLower(params["charset"]); err == nil && charset != "" && !cfg.AcceptedCharsets[charset] {
+			writeLocalizedError(w, r, http.StatusUnsupportedMediaType, "unsupported_charset", charset)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// httpVersionMiddleware answers requests older than MIN_HTTP_VERSION
+// (e.g. 1.1 to forbid HTTP/1.0) with 505. All versions are allowed by default.
+func httpVersionMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if cfg.MinHTTPVersion == "" {
+		return next
+	}
+
+	major, minor, ok := parseHTTPVersion(cfg.MinHTTPVersion)
+	if !ok {
+		log.Fatalf("Invalid MIN_HTTP_VERSION %q: use e.g. 1.1 or 2", cfg.MinHTTPVersion)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < major || (r.ProtoMajor == major && r.ProtoMinor < minor) {
+			writeLocalizedError(w, r, http.StatusHTTPVersionNotSupported, "http_version_not_supported",
+				r.Proto, fmt.Sprintf("HTTP/%d.%d", major, minor))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// parseHTTPVersion reads a version such as "1.1", "2" or "HTTP/2.0".
+// http.ParseHTTPVersion only accepts the "HTTP/1.1" wire form, which
+// HTTP/2 does not have.
+func parseHTTPVersion(v string) (major, minor int, ok bool) {
+	v = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(v)), "HTTP/")
+	rawMajor, rawMinor, hasMinor := strings.Cut(v, ".")
+	major, err := strconv.Atoi(rawMajor)
+	if err != nil || major < 0 {
+		return 0, 0, false
+	}
+	if hasMinor {
+		if minor, err = strconv.Atoi(rawMinor); err != nil || minor < 0 {
+			return 0, 0, false
+		}
+	}
+	return major, minor, true
+}
+
+// traceMethodMiddleware answers TRACE and TRACK with 405 before any
+// handler can reflect the request (cross-site tracing), unless
+// BLOCK_TRACE_METHODS is turned off
+func traceMethodMiddleware(rt *Router) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if !cfg.BlockTraceMethods {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodTrace && r.Method != "TRACK" {
+				next(w, r)
+				return
+			}
+			allowed := make(map[string]bool)
+			for _, method := range rt.AllowedMethods(r.URL.Path) {
+				allowed[method] = true
+			}
+			methodNotAllowed(w, r, allowed)
+		}
+	}
+}
+
+// hostHeaderMiddleware handles requests without a Host header, which
+// HTTP/1.0 allows (net/http already rejects them for HTTP/1.1). With
+// REQUIRE_HOST_HEADER they get 400; otherwise Host is filled in with the
+// address the request arrived on so handlers always see one.
+func hostHeaderMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "" {
+			next(w, r)
+			return
+		}
+
+		if cfg.RequireHostHeader {
+			writeLocalizedError(w, r, http.StatusBadRequest, "missing_host_header")
+			return
+		}
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+			r.Host = addr.String()
+		}
+		next(w, r)
+	}
+}
+
+// countQueryParams counts parameters without parsing the query,
+// so oversized queries are rejected cheaply
+func countQueryParams(rawQuery string) int {
+	count := 0
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part != "" {
+			count++
+		}
+	}
+	return count
+}
+
+func countHeaders(h http.Header) int {
+	count := 0
+	for _, values := range h {
+		count += len(values)
+	}
+	return count
+}
+
+// Made with Bob
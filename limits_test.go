@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func queryWithParams(n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("p%d=1", i)
+	}
+	return "/?" + strings.Join(params, "&")
+}
+
+func TestRequestLimitsPathLength(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MaxPathLength = 16 })
+	handler := requestLimitsMiddleware(okHandler)
+
+	if rec := serve(handler, http.MethodGet, "/"+strings.Repeat("a", 15), ""); rec.Code != http.StatusOK {
+		t.Errorf("at the limit: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	rec := serve(handler, http.MethodGet, "/"+strings.Repeat("a", 16), "")
+	if rec.Code != http.StatusRequestURITooLong {
+		t.Errorf("over the limit: status = %d, want %d", rec.Code, http.StatusRequestURITooLong)
+	}
+	if !strings.Contains(rec.Body.String(), `"error"`) {
+		t.Errorf("over the limit: body = %s, want an ErrorResponse", rec.Body)
+	}
+}
+
+func TestRequestLimitsQueryParams(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MaxQueryParams = 3 })
+	handler := requestLimitsMiddleware(okHandler)
+
+	if rec := serve(handler, http.MethodGet, queryWithParams(3), ""); rec.Code != http.StatusOK {
+		t.Errorf("at the limit: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := serve(handler, http.MethodGet, queryWithParams(4), ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("over the limit: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRequestLimitsHeaders(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MaxHeaders = 3 })
+	handler := requestLimitsMiddleware(okHandler)
+
+	withHeaders := func(n int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for i := 0; i < n; i++ {
+			req.Header.Add("X-Test", fmt.Sprint(i))
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	if rec := withHeaders(3); rec.Code != http.StatusOK {
+		t.Errorf("at the limit: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := withHeaders(4); rec.Code != http.StatusBadRequest {
+		t.Errorf("over the limit: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestParseHTTPVersion(t *testing.T) {
+	tests := []struct {
+		in           string
+		major, minor int
+		ok           bool
+	}{
+		{"1.1", 1, 1, true},
+		{"1.0", 1, 0, true},
+		{"2", 2, 0, true},
+		{"2.0", 2, 0, true},
+		{"HTTP/2", 2, 0, true},
+		{"http/1.1", 1, 1, true},
+		{"two", 0, 0, false},
+		{"1.x", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		major, minor, ok := parseHTTPVersion(tt.in)
+		if major != tt.major || minor != tt.minor || ok != tt.ok {
+			t.Errorf("parseHTTPVersion(%q) = %d, %d, %v, want %d, %d, %v",
+				tt.in, major, minor, ok, tt.major, tt.minor, tt.ok)
+		}
+	}
+}
+
+func TestConcurrencyLimitRejectsExcessUploads(t *testing.T) {
+	setConfig(t, func(c *Config) { c.RetryAfter = 2 * time.Second })
+
+	slots := newConcurrencyLimit(1)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router := NewRouter()
+	router.Handle(http.MethodPost, "/upload", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}, WithConcurrencyLimit(slots))
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(first, httptest.NewRequest(http.MethodPost, "/upload", nil))
+		close(done)
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("second upload status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+
+	close(release)
+	<-done
+	if first.Code != http.StatusCreated {
+		t.Errorf("first upload status = %d, want %d", first.Code, http.StatusCreated)
+	}
+
+	// The slot is free again once the first upload finishes
+	started = make(chan struct{})
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload", nil))
+	if rec.Code != http.StatusCreated {
+		t.Errorf("upload after release status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+}
+
+func TestUploadSlotsGuardRawEcho(t *testing.T) {
+	setConfig(t, func(c *Config) { c.RetryAfter = 2 * time.Second })
+	saved := uploadSlots
+	uploadSlots = newConcurrencyLimit(1)
+	t.Cleanup(func() { uploadSlots = saved })
+	router := newAPIRouter(t)
+	router.Group("/v1", func(g *RouteGroup) { registerAPIv1(g) })
+
+	// An upload in progress holds the only slot
+	uploadSlots <- struct{}{}
+	for _, path := range []string{"/api/echo/raw", "/v1/api/echo/raw"} {
+		rec := serve(router, http.MethodPost, path, "payload")
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "2" {
+			t.Errorf("%s with no free slot: status %d, Retry-After %q; want 503 and 2", path, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+	if rec := serve(router, http.MethodGet, "/api/echo?message=hi", ""); rec.Code != http.StatusOK {
+		t.Errorf("non-upload route: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	<-uploadSlots
+	if rec := serve(router, http.MethodPost, "/api/echo/raw", "payload"); rec.Code != http.StatusOK {
+		t.Errorf("with a free slot: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestConcurrencyLimitDisabled(t *testing.T) {
+	if newConcurrencyLimit(0) != nil {
+		t.Error("newConcurrencyLimit(0) should be nil, allowing any number")
+	}
+}
+
+func TestTraceMethodsRejected(t *testing.T) {
+	setConfig(t, func(c *Config) { c.BlockTraceMethods = true })
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Cookie")))
+	})
+	handler := traceMethodMiddleware(router)(router.ServeHTTP)
+
+	for _, method := range []string{http.MethodTrace, "TRACK"} {
+		rec := httptest.NewRecorder()
+		handler(rec, newRequestWithHeader(method, "/echo", "Cookie", "session=secret"))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s: status = %d, want %d", method, rec.Code, http.StatusMethodNotAllowed)
+		}
+		if strings.Contains(rec.Body.String(), "secret") {
+			t.Errorf("%s: request reflected in the body: %s", method, rec.Body)
+		}
+		if got := rec.Header().Get("Allow"); got != "GET, HEAD" {
+			t.Errorf("%s: Allow = %q, want GET, HEAD", method, got)
+		}
+	}
+
+	cfg.BlockTraceMethods = false
+	called := false
+	traceMethodMiddleware(router)(func(w http.ResponseWriter, r *http.Request) { called = true })(
+		httptest.NewRecorder(), httptest.NewRequest(http.MethodTrace, "/echo", nil))
+	if !called {
+		t.Error("BLOCK_TRACE_METHODS=false still blocked TRACE")
+	}
+}
+
+func TestReadTimeoutScalesWithContentLength(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.ReadTimeout = 10 * time.Second
+		c.ReadTimeoutBytesPerSec = 1 << 20
+		c.ReadTimeoutMax = time.Minute
+	})
+	tests := []struct {
+		contentLength int64
+		want          time.Duration
+	}{
+		{-1, 10 * time.Second},
+		{0, 10 * time.Second},
+		{1 << 20, 11 * time.Second},
+		{20 << 20, 30 * time.Second},
+		{1 << 30, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := readTimeoutFor(tt.contentLength); got != tt.want {
+			t.Errorf("readTimeoutFor(%d) = %v, want %v", tt.contentLength, got, tt.want)
+		}
+	}
+}
+
+// trickleUpload sends a 500-byte body over about 600ms and returns the status
+func trickleUpload(t *testing.T, handler http.HandlerFunc) int {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(handler)
+	ts.Config.ReadTimeout = cfg.ReadTimeout
+	ts.Start()
+	defer ts.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < 10; i++ {
+			time.Sleep(60 * time.Millisecond)
+			pw.Write([]byte(strings.Repeat("x", 50)))
+		}
+		pw.Close()
+	}()
+	req, err := http.NewRequest(http.MethodPost, ts.URL, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ContentLength = 500
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestReadTimeoutAllowsLargeDeclaredBody(t *testing.T) {
+	captureLogs(t)
+	upload := func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	setConfig(t, func(c *Config) {
+		c.ReadTimeout = 200 * time.Millisecond
+		c.ReadTimeoutBytesPerSec = 0
+	})
+	if got := trickleUpload(t, readTimeoutMiddleware(upload)); got == http.StatusCreated {
+		t.Error("without an allowance, a body slower than READ_TIMEOUT was accepted")
+	}
+
+	setConfig(t, func(c *Config) {
+		c.ReadTimeout = 200 * time.Millisecond
+		c.ReadTimeoutBytesPerSec = 500
+		c.ReadTimeoutMax = time.Minute
+	})
+	if got := trickleUpload(t, readTimeoutMiddleware(upload)); got != http.StatusCreated {
+		t.Errorf("with 500 B/s allowance: status = %d, want %d", got, http.StatusCreated)
+	}
+}
+
+// rawRequest writes raw to a new connection to addr and returns the status
+// and body of the response
+func rawRequest(t *testing.T, addr, raw string) (int, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, raw); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestCharsetAllowlist(t *testing.T) {
+	setConfig(t, func(c *Config) { c.CheckRequestCharset = true })
+	handler := charsetMiddleware(okHandler)
+
+	tests := []struct {
+		contentType string
+		want        int
+	}{
+		{"application/json; charset=iso-8859-1", http.StatusUnsupportedMediaType},
+		{"application/json; charset=UTF-8", http.StatusOK},
+		{"application/json", http.StatusOK},
+		{"", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/data", strings.NewReader(`{"name":"a"}`))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%q: status = %d, want %d", tt.contentType, rec.Code, tt.want)
+		}
+		if tt.want == http.StatusUnsupportedMediaType && !strings.Contains(rec.Body.String(), `"code":"unsupported_charset"`) {
+			t.Errorf("%q: body = %s, want an unsupported_charset ErrorResponse", tt.contentType, rec.Body)
+		}
+	}
+
+	cfg.CheckRequestCharset = false
+	req := httptest.NewRequest(http.MethodPost, "/api/data", nil)
+	req.Header.Set("Content-Type", "application/json; charset=iso-8859-1")
+	rec := httptest.NewRecorder()
+	charsetMiddleware(okHandler)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("check disabled: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestHTTP10WithoutHost(t *testing.T) {
+	ts := httptest.NewServer(hostHeaderMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}))
+	defer ts.Close()
+	addr := ts.Listener.Addr().String()
+
+	setConfig(t, func(c *Config) { c.RequireHostHeader = false })
+	status, body := rawRequest(t, addr, "GET / HTTP/1.0\r\n\r\n")
+	if status != http.StatusOK || body != addr {
+		t.Errorf("served: status %d, Host %q; want 200 with the local address %s", status, body, addr)
+	}
+
+	cfg.RequireHostHeader = true
+	if status, body := rawRequest(t, addr, "GET / HTTP/1.0\r\n\r\n"); status != http.StatusBadRequest {
+		t.Errorf("REQUIRE_HOST_HEADER: status %d, body %s; want %d", status, body, http.StatusBadRequest)
+	}
+	if status, body := rawRequest(t, addr, "GET / HTTP/1.0\r\nHost: example.com\r\n\r\n"); status != http.StatusOK || body != "example.com" {
+		t.Errorf("with Host: status %d, Host %q; want 200 with example.com", status, body)
+	}
+}
+
+func TestMinHTTPVersionRejectsHTTP10(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MinHTTPVersion = "1.1" })
+	ts := httptest.NewServer(httpVersionMiddleware(okHandler))
+	defer ts.Close()
+	addr := ts.Listener.Addr().String()
+
+	status, body := rawRequest(t, addr, "GET / HTTP/1.0\r\nHost: test\r\n\r\n")
+	if status != http.StatusHTTPVersionNotSupported {
+		t.Errorf("HTTP/1.0: status = %d, want %d", status, http.StatusHTTPVersionNotSupported)
+	}
+	if !strings.Contains(body, "HTTP/1.0") {
+		t.Errorf("HTTP/1.0: body = %s, want the rejected version named", body)
+	}
+	if status, _ := rawRequest(t, addr, "GET / HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n"); status != http.StatusOK {
+		t.Errorf("HTTP/1.1: status = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestMinHTTPVersionDefaultAllowsAll(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MinHTTPVersion = "" })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/1.0", 1, 0
+	rec := httptest.NewRecorder()
+	httpVersionMiddleware(okHandler)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestExpectContinueOversizedUpload(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MaxBodyBytes = 1024 })
+	called := false
+	ts := httptest.NewServer(requestLimitsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	addr := ts.Listener.Addr().String()
+
+	// The body is never sent: the server must answer the headers alone
+	status, body := rawRequest(t, addr, "POST /upload HTTP/1.1\r\nHost: test\r\n"+
+		"Content-Length: 1048576\r\nExpect: 100-continue\r\n\r\n")
+	if status != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized: status = %d, want %d: %s", status, http.StatusRequestEntityTooLarge, body)
+	}
+	if called {
+		t.Error("oversized upload reached the handler")
+	}
+
+	status, _ = rawRequest(t, addr, "POST /upload HTTP/1.1\r\nHost: test\r\nConnection: close\r\n"+
+		"Content-Length: 5\r\n\r\nhello")
+	if status != http.StatusCreated {
+		t.Errorf("within the limit: status = %d, want %d", status, http.StatusCreated)
+	}
+}
+
+// Made with Bob
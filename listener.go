@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+)
+
+// listen opens the server's TCP listener, applying optional socket tuning
+func listen(addr string, c Config) (net.Listener, error) {
+	lc := net.ListenConfig{}
+
+	if c.ReusePort {
+		if reusePortSupported {
+			lc.Control = reusePortControl
+		} else {
+			log.Printf("Warning: REUSE_PORT is not supported on this platform, ignoring")
+		}
+	}
+
+	ln, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ListenBacklog > 0 {
+		if !listenBacklogSupported {
+			log.Printf("Warning: LISTEN_BACKLOG is not supported on this platform, ignoring")
+		} else if err := setListenBacklog(ln, c.ListenBacklog); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("setting LISTEN_BACKLOG: %w", err)
+		}
+	}
+
+	if c.ProxyProtocol {
+		if c.ProxyProtocolMode != proxyModeRequire && c.ProxyProtocolMode != proxyModeOptional {
+			ln.Close()
+			return nil, fmt.Errorf("invalid PROXY_PROTOCOL_MODE %q: use require or optional", c.ProxyProtocolMode)
+		}
+		log.Printf("Expecting PROXY protocol headers (mode: %s)", c.ProxyProtocolMode)
+		ln = newProxyListener(ln, c.ProxyProtocolMode, c.ReadHeaderTimeout)
+	}
+
+	if c.MaxConnections > 0 {
+		log.Printf("Limiting to %d simultaneous connections", c.MaxConnections)
+		ln = newLimitListener(ln, c.MaxConnections)
+	}
+	return ln, nil
+}
+
+// limitListener caps the number of open connections accepted from the
+// wrapped listener. Once the limit is reached Accept blocks, leaving new
+// connections queued in the kernel backlog until one closes.
+// It mirrors golang.org/x/net/netutil.LimitListener without the dependency.
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newLimitListener(ln net.Listener, n int) *limitListener {
+	return &limitListener{
+		Listener: ln,
+		sem:      make(chan struct{}, n),
+		done:     make(chan struct{}),
+	}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitListenerConn{Conn: conn, release: func() { <-l.sem }}, nil
+}
+
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() { close(l.done) })
+	return err
+}
+
+// limitListenerConn frees its slot in the limitListener when closed
+type limitListenerConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitListenerConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
+
+// Made with Bob
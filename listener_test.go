@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenWrapsWithConnectionLimit(t *testing.T) {
+	captureLogs(t)
+
+	ln, err := listen("127.0.0.1:0", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ln.(*limitListener); ok {
+		t.Error("listener limited without MAX_CONNECTIONS")
+	}
+	ln.Close()
+
+	ln, err = listen("127.0.0.1:0", Config{MaxConnections: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	limited, ok := ln.(*limitListener)
+	if !ok {
+		t.Fatalf("listener is %T, want *limitListener", ln)
+	}
+	if cap(limited.sem) != 3 {
+		t.Errorf("limit = %d, want 3", cap(limited.sem))
+	}
+}
+
+func TestLimitListenerBlocksAtLimit(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := newLimitListener(inner, 1)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		client, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+	}
+
+	first := <-accepted
+	select {
+	case <-accepted:
+		t.Fatal("second connection accepted while at the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.Close()
+	select {
+	case second := <-accepted:
+		second.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("second connection not accepted after the first closed")
+	}
+}
+
+// Made with Bob
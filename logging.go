@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// newLogger builds the structured logger used for leveled output
+func newLogger(c Config, out io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: parseLogLevel(c.LogLevel)}
+	if strings.ToLower(c.LogFormat) == "json" {
+		return slog.New(slog.NewJSONHandler(out, opts))
+	}
+	return slog.New(slog.NewTextHandler(out, opts))
+}
+
+// logFile is an append-mode log destination that can be reopened,
+// so logrotate can move the file and signal us with SIGHUP
+type logFile struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func openLogFile(path string) (*logFile, error) {
+	lf := &logFile{path: path}
+	if err := lf.Reopen(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *logFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.file.Write(p)
+}
+
+// Reopen closes the current file handle and opens the path again
+func (lf *logFile) Reopen() error {
+	f, err := os.OpenFile(lf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	lf.mu.Lock()
+	old := lf.file
+	lf.file = f
+	lf.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// openLogOutput resolves LOG_OUTPUT to a writer, falling back to stderr
+// if a log file cannot be opened
+func openLogOutput(dest string) io.Writer {
+	switch strings.ToLower(dest) {
+	case "", "stderr":
+		return os.Stderr
+	case "stdout":
+		return os.Stdout
+	}
+
+	lf, err := openLogFile(dest)
+	if err != nil {
+		log.Printf("Warning: cannot open log output %q, using stderr: %v", dest, err)
+		return os.Stderr
+	}
+	return lf
+}
+
+// reopenLogOutput reopens a file-based log output after rotation
+func reopenLogOutput(out io.Writer) {
+	lf, ok := out.(*logFile)
+	if !ok {
+		return
+	}
+	if err := lf.Reopen(); err != nil {
+		slog.Error("Failed to reopen log file", "path", lf.path, "error", err)
+		return
+	}
+	slog.Info("Reopened log file", "path", lf.path)
+}
+
+// accessLog receives raw access log lines such as the Common Log Format
+var accessLog io.Writer = os.Stderr
+
+// Timestamp layout used by the Apache Common Log Format
+const commonLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// writeCommonLogLine writes one request in Apache Common Log Format:
+// host ident authuser [date] "request line" status bytes
+func writeCommonLogLine(out io.Writer, r *http.Request, status, bytes int, start time.Time) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+
+	size := "-"
+	if bytes > 0 {
+		size = strconv.Itoa(bytes)
+	}
+
+	fmt.Fprintf(out, "%s - %s [%s] \"%s %s %s\" %d %s\n",
+		host, user, start.Format(commonLogTimeFormat),
+		r.Method, r.RequestURI, r.Proto, status, size)
+}
+
+// accessLogFields are the fields LOG_FIELDS may select, in output order
+var accessLogFields = []string{"method", "path", "status", "duration", "ip", "user_agent", "request_id"}
+
+// parseLogFields keeps the known LOG_FIELDS names, warning about the rest
+func parseLogFields(names []string) []string {
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.ToLower(name)
+		known := false
+		for _, field := range accessLogFields {
+			if field == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			log.Printf("Warning: unknown LOG_FIELDS entry %q, ignoring", name)
+			continue
+		}
+		selected[name] = true
+	}
+
+	var fields []string
+	for _, field := range accessLogFields {
+		if selected[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// logAccessFields writes one access log record containing only the LOG_FIELDS
+// selection, plus retry and last_seen for likely retries
+func logAccessFields(r *http.Request, status int, duration time.Duration, lastSeen time.Duration, retry bool) {
+	args := make([]any, 0, 2*len(cfg.LogFields))
+	for _, field := range cfg.LogFields {
+		switch field {
+		case "method":
+			args = append(args, field, r.Method)
+		case "path":
+			args = append(args, field, r.URL.Path)
+		case "status":
+			args = append(args, field, status)
+		case "duration":
+			args = append(args, field, duration.String())
+		case "ip":
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			args = append(args, field, host)
+		case "user_agent":
+			args = append(args, field, r.UserAgent())
+		case "request_id":
+			args = append(args, field, requestIDFromContext(r.Context()))
+		}
+	}
+	if retry {
+		args = append(args, "retry", "likely", "last_seen", lastSeen.Round(time.Millisecond).String())
+	}
+	slog.Info("request", args...)
+}
+
+// logLifecycle emits a discrete server lifecycle event such as server.started
+func logLifecycle(event string, args ...any) {
+	slog.Info(event, append([]any{"event", event}, args...)...)
+}
+
+func parseLogLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// isClientDisconnect reports whether err comes from the client going away
+// mid-response rather than from a fault on our side
+func isClientDisconnect(err error) bool {
+	return errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, context.Canceled)
+}
+
+// Made with Bob
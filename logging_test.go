@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggingSkipsExcludedPaths(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.LogExcludePaths = map[string]bool{"/health": true}
+	})
+	logs := captureLogs(t)
+	handler := loggingMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve(handler, http.MethodGet, "/health", "")
+	if got := logs.String(); got != "" {
+		t.Errorf("excluded path was logged: %s", got)
+	}
+
+	serve(handler, http.MethodGet, "/api/info", "")
+	if got := logs.String(); !strings.Contains(got, "/api/info") {
+		t.Errorf("other path was not logged: %q", got)
+	}
+}
+
+func TestLoggingReportsFailingExcludedPaths(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.LogExcludePaths = map[string]bool{"/health": true}
+		c.LogExcludedErrors = true
+	})
+	logs := captureLogs(t)
+	handler := loggingMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	serve(handler, http.MethodGet, "/health", "")
+	if got := logs.String(); !strings.Contains(got, "failed with 503") {
+		t.Errorf("failing excluded path was not logged: %q", got)
+	}
+}
+
+func TestSlowRequestWarning(t *testing.T) {
+	setConfig(t, func(c *Config) { c.SlowRequestThreshold = time.Second })
+	fake := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	setClock(t, fake)
+	logs := captureLogs(t)
+
+	handler := loggingMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			fake.Advance(2 * time.Second)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve(handler, http.MethodGet, "/fast", "")
+	if strings.Contains(logs.String(), "Slow request") {
+		t.Errorf("fast request was flagged: %s", logs)
+	}
+
+	serve(handler, http.MethodGet, "/slow", "")
+	out := logs.String()
+	if !strings.Contains(out, `level=WARN msg="Slow request" method=GET path=/slow`) ||
+		!strings.Contains(out, "duration=2s threshold=1s") {
+		t.Errorf("slow request warning missing: %s", out)
+	}
+}
+
+func TestLogLifecycleEmitsStructuredEvents(t *testing.T) {
+	setConfig(t, func(c *Config) { c.LogFormat = "json" })
+	var buf bytes.Buffer
+	setLogger(t, newLogger(cfg, &buf))
+
+	logLifecycle("server.starting", "port", "8080", "version", "1.0.0")
+	logLifecycle("server.stopped", "uptime", "1s")
+
+	var events []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("not a JSON record: %q", line)
+		}
+		events = append(events, event)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0]["msg"] != "server.starting" || events[0]["event"] != "server.starting" ||
+		events[0]["port"] != "8080" || events[0]["version"] != "1.0.0" {
+		t.Errorf("starting event = %v", events[0])
+	}
+	if events[1]["event"] != "server.stopped" || events[1]["uptime"] != "1s" {
+		t.Errorf("stopped event = %v", events[1])
+	}
+}
+
+func TestLogOutputFile(t *testing.T) {
+	captureLogs(t)
+	path := filepath.Join(t.TempDir(), "server.log")
+
+	out := openLogOutput(path)
+	lf, ok := out.(*logFile)
+	if !ok {
+		t.Fatalf("openLogOutput(%q) = %T, want a log file", path, out)
+	}
+	t.Cleanup(func() { lf.file.Close() })
+	fmt.Fprintln(out, "first line")
+
+	// Simulate logrotate moving the file away, then reopening
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	reopenLogOutput(out)
+	fmt.Fprintln(out, "second line")
+
+	if got, _ := os.ReadFile(path + ".1"); string(got) != "first line\n" {
+		t.Errorf("rotated file = %q", got)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "second line\n" {
+		t.Errorf("reopened file = %q", got)
+	}
+}
+
+func TestLogOutputStandardStreams(t *testing.T) {
+	if out := openLogOutput("stdout"); out != os.Stdout {
+		t.Errorf("stdout resolved to %v", out)
+	}
+	if out := openLogOutput(""); out != os.Stderr {
+		t.Errorf("default resolved to %v", out)
+	}
+}
+
+func TestCommonLogFormat(t *testing.T) {
+	setConfig(t, func(c *Config) { c.LogFormat = "clf" })
+	captureLogs(t)
+	setClock(t, newFakeClock(time.Date(2024, 3, 1, 14, 30, 5, 0, time.FixedZone("", -5*60*60))))
+	var out bytes.Buffer
+	saved := accessLog
+	accessLog = &out
+	t.Cleanup(func() { accessLog = saved })
+
+	handler := loggingMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/data?x=1", nil)
+	req.RemoteAddr = "192.0.2.7:51234"
+	req.SetBasicAuth("alice", "secret")
+	handler(httptest.NewRecorder(), req)
+
+	want := `192.0.2.7 - alice [01/Mar/2024:14:30:05 -0500] "POST /api/data?x=1 HTTP/1.1" 201 7` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("CLF line = %q, want %q", got, want)
+	}
+
+	out.Reset()
+	handler = loggingMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/api/data/x", nil))
+	if got := out.String(); !strings.HasSuffix(got, `"DELETE /api/data/x HTTP/1.1" 204 -`+"\n") || !strings.HasPrefix(got, "192.0.2.1 - - [") {
+		t.Errorf("CLF line for an empty anonymous response = %q", got)
+	}
+}
+
+func TestLogFieldsSelection(t *testing.T) {
+	warnings := captureLogs(t)
+	fields := parseLogFields([]string{"Status", "bogus", "method"})
+	if !strings.Contains(warnings.String(), "bogus") {
+		t.Errorf("no warning for the unknown field: %s", warnings)
+	}
+	setConfig(t, func(c *Config) { c.LogFields = fields })
+	setRetries(t, newRetryTracker(time.Minute, 100))
+
+	buf := &logBuffer{}
+	setLogger(t, slog.New(slog.NewJSONHandler(buf, nil)))
+	handler := loggingMiddleware(okHandler)
+	for i := 0; i < 2; i++ {
+		handler(httptest.NewRecorder(), newRequestWithHeader(http.MethodGet, "/api/info", "Idempotency-Key", "k1"))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %s", len(lines), buf)
+	}
+	for i, line := range lines {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		delete(record, "time")
+		delete(record, "level")
+		delete(record, "msg")
+		want := map[string]any{"method": "GET", "status": float64(200)}
+		if i == 1 {
+			want["retry"], want["last_seen"] = "likely", record["last_seen"]
+		}
+		if fmt.Sprint(record) != fmt.Sprint(want) {
+			t.Errorf("line %d fields = %v, want %v", i+1, record, want)
+		}
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// How long a resolved hostname is reused before looking it up again
+const hostnameCacheTTL = 10 * time.Second
+
+// cachedLookup runs an expensive lookup at most once at a time: concurrent
+// callers share the in-flight call, and successful results are cached for ttl.
+// If a refresh fails after an earlier success, the last good value is returned.
+type cachedLookup struct {
+	fn    func() (string, error)
+	ttl   time.Duration
+	clock Clock
+
+	mu       sync.Mutex
+	value    string
+	hasValue bool
+	expires  time.Time
+	call     *lookupCall
+}
+
+// lookupCall is an in-flight lookup that later callers wait on
+type lookupCall struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+func newCachedLookup(fn func() (string, error), ttl time.Duration) *cachedLookup {
+	return &cachedLookup{fn: fn, ttl: ttl, clock: clock}
+}
+
+var hostnameLookup = newCachedLookup(os.Hostname, hostnameCacheTTL)
+
+func (c *cachedLookup) Get() (string, error) {
+	c.mu.Lock()
+	if c.clock.Now().Before(c.expires) {
+		value := c.value
+		c.mu.Unlock()
+		return value, nil
+	}
+	if call := c.call; call != nil {
+		c.mu.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+
+	call := &lookupCall{done: make(chan struct{})}
+	c.call = call
+	c.mu.Unlock()
+
+	call.value, call.err = c.fn()
+
+	c.mu.Lock()
+	switch {
+	case call.err == nil:
+		c.value = call.value
+		c.hasValue = true
+		c.expires = c.clock.Now().Add(c.ttl)
+	case c.hasValue:
+		// Serve the last good value rather than flapping on transient failures
+		slog.Warn("Lookup failed, serving last known value", "error", call.err, "value", c.value)
+		call.value, call.err = c.value, nil
+	}
+	c.call = nil
+	c.mu.Unlock()
+	close(call.done)
+
+	return call.value, call.err
+}
+
+// Made with Bob
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachedLookupSharesConcurrentCalls(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	lookup := newCachedLookup(func() (string, error) {
+		calls.Add(1)
+		<-release
+		return "host", nil
+	}, time.Minute)
+
+	const callers = 20
+	var wg sync.WaitGroup
+	results := make(chan string, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := lookup.Get()
+			if err != nil {
+				t.Error(err)
+			}
+			results <- value
+		}()
+	}
+
+	// Let every caller reach the in-flight lookup before it completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("lookup ran %d times, want 1", got)
+	}
+	for value := range results {
+		if value != "host" {
+			t.Errorf("caller got %q, want %q", value, "host")
+		}
+	}
+}
+
+func TestCachedLookupCachesForTTL(t *testing.T) {
+	fake := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var calls int
+	lookup := newCachedLookup(func() (string, error) {
+		calls++
+		return "host", nil
+	}, 10*time.Second)
+	lookup.clock = fake
+
+	lookup.Get()
+	fake.Advance(5 * time.Second)
+	lookup.Get()
+	if calls != 1 {
+		t.Errorf("lookup ran %d times within the TTL, want 1", calls)
+	}
+
+	fake.Advance(10 * time.Second)
+	lookup.Get()
+	if calls != 2 {
+		t.Errorf("lookup ran %d times after the TTL, want 2", calls)
+	}
+}
+
+func TestCachedLookupServesLastGoodValue(t *testing.T) {
+	captureLogs(t)
+	fake := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var fail bool
+	lookup := newCachedLookup(func() (string, error) {
+		if fail {
+			return "", errors.New("resolver unavailable")
+		}
+		return "host", nil
+	}, 10*time.Second)
+	lookup.clock = fake
+
+	if value, err := lookup.Get(); err != nil || value != "host" {
+		t.Fatalf("first lookup = %q, %v", value, err)
+	}
+
+	fail = true
+	fake.Advance(time.Minute)
+	if value, err := lookup.Get(); err != nil || value != "host" {
+		t.Errorf("failed refresh = %q, %v; want the last good value", value, err)
+	}
+}
+
+func TestInfoHostnameUnknownWithoutSuccess(t *testing.T) {
+	setConfig(t, nil)
+	saved := hostnameLookup
+	hostnameLookup = newCachedLookup(func() (string, error) {
+		return "", errors.New("resolver unavailable")
+	}, time.Minute)
+	t.Cleanup(func() { hostnameLookup = saved })
+
+	_, body, err := infoHandler(httptest.NewRequest(http.MethodGet, "/api/info", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := body.(InfoResponse).Hostname; got != "unknown" {
+		t.Errorf("hostname = %q, want unknown", got)
+	}
+}
+
+// Made with Bob
@@ -2,37 +2,41 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
 
 var (
-	startTime = time.Now()
+	startTime = clock.Now()
 	version   = "1.0.0"
 )
 
 // Response structures
 type HealthResponse struct {
-	Status  string `json:"status"`
-	Uptime  string `json:"uptime"`
-	Version string `json:"version"`
+	Status  string       `json:"status"`
+	Uptime  JSONDuration `json:"uptime"`
+	Version string       `json:"version"`
 }
 
 type InfoResponse struct {
-	Version   string    `json:"version"`
-	Hostname  string    `json:"hostname"`
-	Timestamp time.Time `json:"timestamp"`
-	Message   string    `json:"message"`
+	Version   string   `json:"version"`
+	Hostname  string   `json:"hostname"`
+	Timestamp JSONTime `json:"timestamp"`
+	Message   string   `json:"message"`
 }
 
 type EchoResponse struct {
-	Message   string    `json:"message"`
-	Timestamp time.Time `json:"timestamp"`
+	Message   string   `json:"message"`
+	Timestamp JSONTime `json:"timestamp"`
 }
 
 type DataRequest struct {
@@ -43,188 +47,464 @@ type DataRequest struct {
 type DataResponse struct {
 	Success   bool        `json:"success"`
 	Data      DataRequest `json:"data"`
-	Timestamp time.Time   `json:"timestamp"`
+	Timestamp JSONTime    `json:"timestamp"`
 }
 
 type ErrorResponse struct {
-	Error     string    `json:"error"`
-	Timestamp time.Time `json:"timestamp"`
+	Error     string   `json:"error"`
+	Code      string   `json:"code,omitempty"`
+	Detail    string   `json:"detail,omitempty"`
+	Timestamp JSONTime `json:"timestamp"`
 }
 
 // Middleware for logging requests
 func loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		log.Printf("[%s] %s %s", r.Method, r.URL.Path, r.RemoteAddr)
+		start := clock.Now()
+
+		// Checked for every request, whatever the format, so retries are
+		// recorded and annotated consistently
+		lastSeen, retry := retries.Seen(retryKey(r))
+		retryNote := ""
+		if retry {
+			retryNote = fmt.Sprintf(" retry=likely last_seen=%v", lastSeen.Round(time.Millisecond))
+		}
+
+		// Excluded paths (e.g. probes) are served silently unless they fail
+		if cfg.LogExcludePaths[r.URL.Path] {
+			rec := newStatusRecorder(w)
+			next(rec, r)
+			duration := clock.Since(start)
+			if cfg.LogExcludedErrors && rec.status >= http.StatusInternalServerError {
+				log.Printf("[%s] %s %s failed with %d in %v request_id=%s%s", r.Method, r.URL.Path, r.RemoteAddr, rec.status, duration,
+					requestIDFromContext(r.Context()), retryNote)
+			}
+			warnIfSlow(r, duration)
+			return
+		}
+
+		if strings.ToLower(cfg.LogFormat) == "clf" {
+			rec := newStatusRecorder(w)
+			next(rec, r)
+			writeCommonLogLine(accessLog, r, rec.status, rec.bytes, start)
+			// CLF lines have a fixed set of fields, so retries are noted apart
+			if retry {
+				slog.Info("Likely retry",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"request_id", requestIDFromContext(r.Context()),
+					"last_seen", lastSeen.Round(time.Millisecond).String(),
+				)
+			}
+			warnIfSlow(r, clock.Since(start))
+			return
+		}
+
+		if len(cfg.LogFields) > 0 {
+			rec := newStatusRecorder(w)
+			next(rec, r)
+			duration := clock.Since(start)
+			logAccessFields(r, rec.status, duration, lastSeen, retry)
+			warnIfSlow(r, duration)
+			return
+		}
+
+		line := fmt.Sprintf("[%s] %s %s request_id=%s", r.Method, r.URL.Path, r.RemoteAddr, requestIDFromContext(r.Context()))
+		if id, ok := clientIdentityFromContext(r.Context()); ok {
+			line += " client=" + id.String()
+		}
+		log.Print(line + retryNote)
 		next(w, r)
-		log.Printf("Completed in %v", time.Since(start))
+		duration := clock.Since(start)
+		log.Printf("Completed in %v", duration)
+		warnIfSlow(r, duration)
 	}
 }
 
-// CORS middleware
-func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// warnIfSlow flags requests slower than SLOW_REQUEST_THRESHOLD
+func warnIfSlow(r *http.Request, duration time.Duration) {
+	if cfg.SlowRequestThreshold > 0 && duration > cfg.SlowRequestThreshold {
+		slog.Warn("Slow request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"request_id", requestIDFromContext(r.Context()),
+			"duration", duration.String(),
+			"threshold", cfg.SlowRequestThreshold.String(),
+		)
+	}
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// CORS middleware. Allowed methods come from the routes registered for the
+// requested path, falling back to CORS_ALLOWED_METHODS for unknown paths.
+func corsMiddleware(rt *Router) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			methods := corsAllowedMethods(rt, r.URL.Path)
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			// Headers clients send on purpose: auth, request IDs for
+			// tracing and idempotency keys for retries
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join([]string{
+				"Content-Type", "Authorization", cfg.RequestIDHeader, "Idempotency-Key",
+			}, ", "))
+			if len(cfg.CORSExposeHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(cfg.CORSExposeHeaders, ", "))
+			}
+
+			if r.Method == "OPTIONS" {
+				w.Header().Set("Allow", methods)
+				if cfg.CORSMaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.CORSMaxAge))
+				}
+				w.WriteHeader(cfg.OptionsStatus)
+				return
+			}
+
+			next(w, r)
 		}
+	}
+}
 
-		next(w, r)
+// corsAllowedMethods builds the Access-Control-Allow-Methods value for path
+func corsAllowedMethods(rt *Router, path string) string {
+	methods := rt.AllowedMethods(path)
+	if len(methods) == 0 {
+		return strings.Join(cfg.CORSAllowedMethods, ", ")
 	}
+	return strings.Join(append(methods, http.MethodOptions), ", ")
 }
 
 // Handler functions
 func homeHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
 	response := map[string]string{
 		"message":   "Welcome to Go HTTP Server!",
 		"version":   version,
-		"endpoints": "/health, /api/info, /api/echo?message=<text>, /api/data (POST)",
+		"endpoints": "/health, /health/summary, /status, /readiness, /metrics, /api/info, /api/echo?message=<text>, /api/echo/full, /api/echo/raw (POST), /api/data (POST), /api/data/{name} (GET, PUT, PATCH, DELETE), /api/data/jobs/{id}",
+		"versions":  apiVersionPrefixes(),
 	}
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, response)
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	uptime := time.Since(startTime)
-
 	response := HealthResponse{
 		Status:  "healthy",
-		Uptime:  uptime.String(),
+		Uptime:  JSONDuration{uptime()},
 		Version: version,
 	}
 
-	json.NewEncoder(w).Encode(response)
-}
+	if shuttingDown.Load() {
+		response.Status = "shutting_down"
+		writeJSON(w, http.StatusServiceUnavailable, response)
+		return
+	}
 
-func infoHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, response)
+}
 
-	hostname, err := os.Hostname()
+func infoHandler(r *http.Request) (int, interface{}, error) {
+	hostname, err := hostnameLookup.Get()
 	if err != nil {
 		hostname = "unknown"
 	}
 
-	response := InfoResponse{
+	return http.StatusOK, InfoResponse{
 		Version:   version,
 		Hostname:  hostname,
-		Timestamp: time.Now(),
+		Timestamp: nowFunc(),
 		Message:   "Server information retrieved successfully",
-	}
-
-	json.NewEncoder(w).Encode(response)
+	}, nil
 }
 
-func echoHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
+func echoHandler(r *http.Request) (int, interface{}, error) {
 	message := r.URL.Query().Get("message")
 	if message == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{
-			Error:     "Missing 'message' query parameter",
-			Timestamp: time.Now(),
-		})
-		return
+		message = cfg.EchoDefault
+	}
+	if message == "" && !cfg.EchoEmptyOK {
+		return 0, nil, apiError(http.StatusBadRequest, "missing_parameter", "message")
 	}
 
-	response := EchoResponse{
-		Message:   message,
-		Timestamp: time.Now(),
+	switch encoding := r.URL.Query().Get("encoding"); encoding {
+	case "", "plain":
+	case "base64":
+		decoded, err := decodeBase64(message)
+		if err != nil {
+			return 0, nil, apiError(http.StatusBadRequest, "invalid_base64", "message")
+		}
+		message = string(decoded)
+	default:
+		return 0, nil, apiError(http.StatusBadRequest, "unsupported_encoding", encoding)
 	}
 
-	json.NewEncoder(w).Encode(response)
+	return http.StatusOK, EchoResponse{
+		Message:   message,
+		Timestamp: nowFunc(),
+	}, nil
 }
 
-func dataHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(ErrorResponse{
-			Error:     "Method not allowed. Use POST",
-			Timestamp: time.Now(),
-		})
-		return
+func dataHandler(r *http.Request) (int, interface{}, error) {
+	var req DataRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		if requestCancelled(r) {
+			return 0, nil, errRequestCancelled
+		}
+		return 0, nil, apiError(http.StatusBadRequest, "invalid_json")
+	}
+	if req.Name == "" {
+		return 0, nil, apiError(http.StatusBadRequest, "missing_field", "name")
+	}
+	if requestCancelled(r) {
+		return 0, nil, errRequestCancelled
 	}
 
-	var req DataRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{
-			Error:     "Invalid JSON payload",
-			Timestamp: time.Now(),
-		})
-		return
+	if dataJobs != nil {
+		return enqueueDataHandler(r, req)
 	}
 
-	response := DataResponse{
+	dataStore.Put(req)
+
+	return http.StatusCreated, DataResponse{
 		Success:   true,
 		Data:      req,
-		Timestamp: time.Now(),
-	}
+		Timestamp: nowFunc(),
+	}, nil
+}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+// newServer builds the HTTP server for handler with the configured timeouts
+func newServer(c Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + c.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       60 * time.Second,
+	}
 }
 
 func main() {
-	// Get port from environment variable or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Load configuration from environment variables
+	cfg = LoadConfig()
+	port := cfg.Port
+
+	logOutput := openLogOutput(cfg.LogOutput)
+	slog.SetDefault(newLogger(cfg, logOutput))
+	accessLog = logOutput
+	auditOutput := openLogOutput(cfg.AuditLogOutput)
+	auditLog = slog.New(slog.NewJSONHandler(auditOutput, nil))
+
+	maintenanceMode.Store(cfg.MaintenanceMode)
+
+	// Reopen log files and reload maintenance mode on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reopenLogOutput(logOutput)
+			reopenLogOutput(auditOutput)
+			reloadMaintenanceMode()
+		}
+	}()
+
+	if cfg.OTelEnabled {
+		spanExporter = newOTLPExporter(cfg.OTelEndpoint, cfg.OTelServiceName)
+		log.Printf("Tracing enabled, exporting to %s", cfg.OTelEndpoint)
+	}
+
+	recentRequests = newRequestRing(cfg.RecentRequestsSize)
+	retries = newRetryTracker(cfg.RetryDetectionWindow, cfg.RetryDetectionMaxKeys)
+	featureFlags = NewFlagStore(cfg.FeatureFlags)
+	if len(cfg.FeatureFlags) > 0 {
+		log.Printf("Feature flags: %v", flagNames(cfg.FeatureFlags))
+	}
+
+	uploadSlots = newConcurrencyLimit(cfg.MaxConcurrentUploads)
+	if cfg.AsyncData {
+		dataJobs = newJobQueue(cfg.DataWorkers, cfg.DataQueueSize, cfg.JobRetention)
+		log.Printf("Async data processing enabled: %d workers, queue depth %d", cfg.DataWorkers, cfg.DataQueueSize)
+	}
+
+	// Setup readiness checks
+	if cfg.WorkDir != "" {
+		registerDependencyCheck("work_dir", workDirCheck(cfg.WorkDir))
+	}
+	if len(cfg.DependencyURLs) > 0 {
+		checkClient = newCheckClient(cfg)
+		for _, url := range cfg.DependencyURLs {
+			registerDependencyCheck(url, httpCheck(url))
+		}
+	}
+	if cfg.ChaosEnabled {
+		registerStateCheck("chaos", func(ctx context.Context) error {
+			return chaosReadiness.Check()
+		})
+	}
+
+	// Setup routes. Unversioned /api routes are aliases of the oldest version.
+	router := NewRouter()
+	router.Timeout = cfg.HandlerTimeout
+	router.RouteTimeouts = cfg.RouteTimeouts
+	router.RateLimit = cfg.RateLimit
+	router.MaxRoutes = cfg.MaxRoutes
+	router.Handle(http.MethodGet, "/", cacheable(homeHandler))
+	router.Handle(http.MethodGet, "/health", dynamic(healthHandler))
+	router.Handle(http.MethodGet, "/readiness", dynamic(readinessHandler))
+	router.Handle(http.MethodGet, "/health/summary", dynamic(healthSummaryHandler))
+	router.Handle(http.MethodGet, "/status", dynamic(statusHandler))
+	if cfg.MetricsEnabled {
+		router.Handle(http.MethodGet, "/metrics", dynamic(metricsRegistry.ServeHTTP))
+	}
+	apiVersions[0].register(router)
+	for _, v := range apiVersions {
+		router.Group(v.prefix, func(g *RouteGroup) { v.register(g) })
+	}
+
+	// Admin routes
+	router.Handle(http.MethodGet, "/admin/recent", dynamic(adminMiddleware(recentRequestsHandler)))
+	router.Handle(http.MethodGet, "/admin/flags", dynamic(adminMiddleware(listFlagsHandler)))
+	router.Handle(http.MethodPut, "/admin/flags/{name}", dynamic(adminMiddleware(setFlagHandler)))
+	router.Handle(http.MethodGet, "/admin/middleware", dynamic(adminMiddleware(middlewareHandler)))
+	if cfg.ChaosEnabled {
+		router.Handle(http.MethodPost, "/admin/readiness/fail", dynamic(adminMiddleware(readinessFailHandler)))
+		router.Handle(http.MethodPost, "/admin/gc", dynamic(adminMiddleware(gcHandler)))
+		router.Handle(http.MethodPost, "/admin/replay", dynamic(adminMiddleware(replayHandler(router))))
 	}
 
-	// Setup routes with middleware
-	http.HandleFunc("/", corsMiddleware(loggingMiddleware(homeHandler)))
-	http.HandleFunc("/health", corsMiddleware(loggingMiddleware(healthHandler)))
-	http.HandleFunc("/api/info", corsMiddleware(loggingMiddleware(infoHandler)))
-	http.HandleFunc("/api/echo", corsMiddleware(loggingMiddleware(echoHandler)))
-	http.HandleFunc("/api/data", corsMiddleware(loggingMiddleware(dataHandler)))
+	// Middleware stack, outermost first
+	middlewareStack = []NamedMiddleware{
+		{"in_flight", inFlightMiddleware},
+		{"tracing", tracingMiddleware},
+		{"metrics", metricsMiddleware},
+		{"request_id", requestIDMiddleware},
+		{"pretty", prettyMiddleware},
+		{"fields", fieldsMiddleware},
+		{"language", languageMiddleware},
+		{"client_identity", clientIdentityMiddleware},
+		{"recent_requests", recentRequestsMiddleware},
+		{"custom_headers", customHeadersMiddleware},
+		{"compress", gzipMiddleware},
+		{"cors", corsMiddleware(router)},
+		{"logging", loggingMiddleware},
+		{"conn_limit", connLimitMiddleware},
+		{"startup_gate", startupGateMiddleware},
+		{"maintenance", maintenanceMiddleware},
+		{"auth", authMiddleware},
+		{"recovery", recoveryMiddleware},
+		{"http_version", httpVersionMiddleware},
+		{"trace_method", traceMethodMiddleware(router)},
+		{"host_header", hostHeaderMiddleware},
+		{"request_limits", requestLimitsMiddleware},
+		{"read_timeout", readTimeoutMiddleware},
+		{"charset", charsetMiddleware},
+		{"decompress", decompressMiddleware},
+	}
+	handler := chainNamed(router.ServeHTTP, middlewareStack)
 
 	// Create server
-	server := &http.Server{
-		Addr:         ":" + port,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	server := newServer(cfg, handler)
+
+	var connHooks []func(net.Conn, http.ConnState)
+	if cfg.MaxConnPerIP > 0 {
+		connHooks = append(connHooks, connTracker.ConnState)
+	}
+	if cfg.IdleDrain > 0 {
+		connHooks = append(connHooks, openConns.ConnState)
+	}
+	server.ConnState = combineConnState(connHooks)
+
+	shutdownSignals, err := parseShutdownSignals(cfg.ShutdownSignals)
+	if err != nil {
+		log.Fatalf("Invalid SHUTDOWN_SIGNALS: %v", err)
+	}
+
+	useTLS := cfg.TLSCertFile != "" || cfg.TLSKeyFile != ""
+	if useTLS {
+		if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			log.Fatalf("Invalid TLS configuration: TLS_CERT_FILE and TLS_KEY_FILE must both be set")
+		}
+		tlsCfg, err := buildTLSConfig(cfg)
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		server.TLSConfig = tlsCfg
 	}
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Starting server on port %s...", port)
-		log.Printf("Server version: %s", version)
+		logLifecycle("server.starting", "port", port, "version", version)
 		log.Printf("Available endpoints:")
 		log.Printf("  GET  /")
 		log.Printf("  GET  /health")
+		log.Printf("  GET  /readiness")
+		log.Printf("  GET  /health/summary")
+		log.Printf("  GET  /status")
+		log.Printf("  GET  /metrics")
 		log.Printf("  GET  /api/info")
 		log.Printf("  GET  /api/echo?message=<text>")
+		log.Printf("  GET  /api/echo/full")
+		log.Printf("  POST /api/echo/full")
+		log.Printf("  POST /api/echo/raw")
 		log.Printf("  POST /api/data")
+		log.Printf("  GET  /api/data/{name}")
+		log.Printf("  PUT  /api/data/{name}")
+		log.Printf("  PATCH /api/data/{name}")
+		log.Printf("  DELETE /api/data/{name}")
+		log.Printf("  GET  /api/data/jobs/{id}")
+		log.Printf("  *    %s prefixed /api routes", apiVersionPrefixes())
+		log.Printf("  GET  /admin/recent")
+		log.Printf("  GET  /admin/flags")
+		log.Printf("  PUT  /admin/flags/{name}")
+		log.Printf("  GET  /admin/middleware")
+		log.Printf("  POST /admin/readiness/fail")
+		log.Printf("  POST /admin/gc")
+		log.Printf("  POST /admin/replay")
+
+		log.Printf("Read header timeout: %v", server.ReadHeaderTimeout)
+		if cfg.MaxConnPerIP > 0 {
+			log.Printf("Limiting to %d connections per client IP", cfg.MaxConnPerIP)
+		}
+		if cfg.ReusePort {
+			log.Printf("SO_REUSEPORT enabled")
+		}
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := checkStartupDependencies(cfg); err != nil {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+
+		ln, err := listen(server.Addr, cfg)
+		if err != nil {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+		ln = newDrainListener(ln)
+		logLifecycle("server.started", "port", port, "version", version, "addr", ln.Addr().String())
+		warmUp(cfg.StartupWarmup)
+
+		if useTLS {
+			log.Printf("TLS enabled, minimum version %s", cfg.TLSMinVersion)
+			if cfg.TLSClientCA != "" {
+				log.Printf("Client certificates required, verified against %s", cfg.TLSClientCA)
+			}
+			err = server.ServeTLS(ln, cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed to start: %v", err)
 		}
 	}()
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Println("Shutting down server...")
+	signal.Notify(quit, shutdownSignals...)
+	sig := waitForShutdownSignal(quit)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	logLifecycle("server.shutting_down", "signal", sig.String(), "uptime", uptime().String())
 
-	if err := server.Shutdown(ctx); err != nil {
+	if err := gracefulShutdown(server, shutdownConfigFor(sig, cfg)); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
-	log.Println("Server stopped gracefully")
+	logLifecycle("server.stopped", "uptime", uptime().String())
 }
 
 // Made with Bob
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setConfig replaces the global cfg with the defaults changed by modify for
+// the rest of the test
+func setConfig(t *testing.T, modify func(c *Config)) {
+	t.Helper()
+	saved := cfg
+	cfg = LoadConfig()
+	if modify != nil {
+		modify(&cfg)
+	}
+	t.Cleanup(func() { cfg = saved })
+}
+
+// setClock replaces the global clock for the rest of the test
+func setClock(t *testing.T, c Clock) {
+	t.Helper()
+	saved := clock
+	clock = c
+	t.Cleanup(func() { clock = saved })
+}
+
+// newAPIRouter returns a router serving the v1 API over an empty data store
+func newAPIRouter(t *testing.T) *Router {
+	t.Helper()
+	saved := dataStore
+	dataStore = NewDataStore()
+	t.Cleanup(func() { dataStore = saved })
+
+	router := NewRouter()
+	registerAPIv1(router)
+	return router
+}
+
+// serve sends a request with the given body, and a JSON Content-Type when
+// there is one, to h and returns the recorded response
+func serve(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// newRequestWithHeader builds a request with one header set, if name is given
+func newRequestWithHeader(method, target, name, value string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	if name != "" {
+		req.Header.Set(name, value)
+	}
+	return req
+}
+
+// logBuffer collects log output written from several goroutines
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// setLogger makes logger the default for log and slog for the rest of the test
+func setLogger(t *testing.T, logger *slog.Logger) {
+	t.Helper()
+	savedLogger, savedOutput, savedFlags := slog.Default(), log.Writer(), log.Flags()
+	slog.SetDefault(logger)
+	t.Cleanup(func() {
+		slog.SetDefault(savedLogger)
+		log.SetOutput(savedOutput)
+		log.SetFlags(savedFlags)
+	})
+}
+
+// captureLogs sends log and slog output, debug level included, to the
+// returned buffer for the rest of the test
+func captureLogs(t *testing.T) *logBuffer {
+	t.Helper()
+	buf := &logBuffer{}
+	setLogger(t, slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	return buf
+}
+
+func TestCORSExposeHeadersAndMaxAge(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.CORSExposeHeaders = []string{"X-Request-ID", "X-Total-Count"}
+		c.CORSMaxAge = 300
+	})
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/items", okHandler)
+	handler := corsMiddleware(router)(router.ServeHTTP)
+
+	preflight := serve(handler, http.MethodOptions, "/items", "")
+	if got := preflight.Header().Get("Access-Control-Max-Age"); got != "300" {
+		t.Errorf("preflight Access-Control-Max-Age = %q, want 300", got)
+	}
+
+	get := serve(handler, http.MethodGet, "/items", "")
+	if got := get.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-ID, X-Total-Count" {
+		t.Errorf("Access-Control-Expose-Headers = %q", got)
+	}
+	if got := get.Header().Get("Access-Control-Max-Age"); got != "" {
+		t.Errorf("non-preflight response has Access-Control-Max-Age %q", got)
+	}
+}
+
+func TestCORSMaxAgeDisabled(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.CORSExposeHeaders = nil
+		c.CORSMaxAge = 0
+	})
+	router := NewRouter()
+	handler := corsMiddleware(router)(router.ServeHTTP)
+
+	rec := serve(handler, http.MethodOptions, "/items", "")
+	for _, name := range []string{"Access-Control-Max-Age", "Access-Control-Expose-Headers"} {
+		if got := rec.Header().Get(name); got != "" {
+			t.Errorf("%s = %q, want it unset", name, got)
+		}
+	}
+}
+
+func TestCORSAllowedMethodsFromRouter(t *testing.T) {
+	setConfig(t, func(c *Config) { c.CORSAllowedMethods = []string{"GET", "OPTIONS"} })
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/items/{id}", okHandler)
+	router.Handle(http.MethodPut, "/items/{id}", okHandler)
+	handler := corsMiddleware(router)(router.ServeHTTP)
+
+	rec := serve(handler, http.MethodOptions, "/items/42", "")
+	methods := rec.Header().Get("Access-Control-Allow-Methods")
+	if !strings.Contains(methods, http.MethodPut) {
+		t.Errorf("preflight for a PUT route allows %q, want PUT", methods)
+	}
+	if strings.Contains(methods, http.MethodPost) {
+		t.Errorf("preflight allows unregistered POST: %q", methods)
+	}
+
+	// Paths with no route fall back to CORS_ALLOWED_METHODS
+	if got := serve(handler, http.MethodOptions, "/nowhere", "").Header().Get("Access-Control-Allow-Methods"); got != "GET, OPTIONS" {
+		t.Errorf("unrouted preflight allows %q, want the configured default", got)
+	}
+}
+
+func TestOptionsAllowHeaderPerRoute(t *testing.T) {
+	setConfig(t, nil)
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/items/{id}", okHandler)
+	router.Handle(http.MethodDelete, "/items/{id}", okHandler)
+	router.Handle(http.MethodPost, "/items", okHandler)
+	handler := corsMiddleware(router)(router.ServeHTTP)
+
+	tests := []struct {
+		path, want string
+	}{
+		{"/items/42", "DELETE, GET, HEAD, OPTIONS"},
+		{"/items", "POST, OPTIONS"},
+	}
+	for _, tt := range tests {
+		rec := serve(handler, http.MethodOptions, tt.path, "")
+		allow := rec.Header().Get("Allow")
+		if allow != tt.want {
+			t.Errorf("%s: Allow = %q, want %q", tt.path, allow, tt.want)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Methods"); got != allow {
+			t.Errorf("%s: Access-Control-Allow-Methods = %q, want it to match Allow %q", tt.path, got, allow)
+		}
+	}
+}
+
+func TestServerReadHeaderTimeout(t *testing.T) {
+	t.Setenv("READ_HEADER_TIMEOUT", "")
+	if got := newServer(LoadConfig(), nil).ReadHeaderTimeout; got != 5*time.Second {
+		t.Errorf("default ReadHeaderTimeout = %v, want 5s", got)
+	}
+
+	t.Setenv("READ_HEADER_TIMEOUT", "2s")
+	if got := newServer(LoadConfig(), nil).ReadHeaderTimeout; got != 2*time.Second {
+		t.Errorf("ReadHeaderTimeout = %v, want READ_HEADER_TIMEOUT 2s", got)
+	}
+}
+
+// Made with Bob
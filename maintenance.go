@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// maintenanceMode is read on every request and can be flipped at runtime
+// by changing MAINTENANCE_MODE in CONFIG_FILE and sending SIGHUP
+var maintenanceMode atomic.Bool
+
+// maintenanceMiddleware answers 503 with Retry-After while maintenance mode is on
+func maintenanceMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !maintenanceMode.Load() || probePaths[r.URL.Path] {
+			next(w, r)
+			return
+		}
+
+		if cfg.MaintenanceRetryAfter > 0 {
+			setRetryAfter(w, cfg.MaintenanceRetryAfter)
+		}
+		writeLocalizedError(w, r, http.StatusServiceUnavailable, "maintenance")
+	}
+}
+
+// reloadMaintenanceMode re-reads MAINTENANCE_MODE from the environment and
+// CONFIG_FILE. Errors keep the current mode.
+func reloadMaintenanceMode() {
+	raw := os.Getenv("MAINTENANCE_MODE")
+	if raw == "" {
+		values, err := readConfigFile(os.Getenv("CONFIG_FILE"))
+		if err != nil {
+			slog.Error("Failed to reload maintenance mode", "error", err)
+			return
+		}
+		raw = values["MAINTENANCE_MODE"]
+	}
+
+	enabled := false
+	if raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			slog.Error("Failed to reload maintenance mode", "error", "invalid boolean "+strconv.Quote(raw))
+			return
+		}
+		enabled = parsed
+	}
+
+	if maintenanceMode.Swap(enabled) == enabled {
+		return
+	}
+	if enabled {
+		log.Printf("Maintenance mode enabled")
+	} else {
+		log.Printf("Maintenance mode disabled")
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// setMaintenance sets maintenance mode for the rest of the test
+func setMaintenance(t *testing.T, on bool) {
+	t.Helper()
+	saved := maintenanceMode.Load()
+	maintenanceMode.Store(on)
+	t.Cleanup(func() { maintenanceMode.Store(saved) })
+}
+
+func newMaintenanceHandler() http.HandlerFunc {
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/health", healthHandler)
+	router.Handle(http.MethodGet, "/readiness", readinessHandler)
+	router.Handle(http.MethodGet, "/api/info", okHandler)
+	return maintenanceMiddleware(router.ServeHTTP)
+}
+
+func TestMaintenanceOn(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.MaintenanceRetryAfter = 2 * time.Minute
+		c.MaintenanceFailReadiness = true
+	})
+	setReadiness(t)
+	setMaintenance(t, true)
+	handler := newMaintenanceHandler()
+
+	rec := serve(handler, http.MethodGet, "/api/info", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("API: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "120" {
+		t.Errorf("API: Retry-After = %q, want 120", got)
+	}
+	if rec := serve(handler, http.MethodGet, "/health", ""); rec.Code != http.StatusOK {
+		t.Errorf("health: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := serve(handler, http.MethodGet, "/readiness", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readiness: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestMaintenanceKeepsReadiness(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MaintenanceFailReadiness = false })
+	setReadiness(t)
+	setMaintenance(t, true)
+
+	if rec := serve(newMaintenanceHandler(), http.MethodGet, "/readiness", ""); rec.Code != http.StatusOK {
+		t.Errorf("readiness: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestMaintenanceOff(t *testing.T) {
+	setConfig(t, nil)
+	setMaintenance(t, false)
+
+	if rec := serve(newMaintenanceHandler(), http.MethodGet, "/api/info", ""); rec.Code != http.StatusOK {
+		t.Errorf("API: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestReloadMaintenanceMode(t *testing.T) {
+	captureLogs(t)
+	setMaintenance(t, false)
+	t.Setenv("MAINTENANCE_MODE", "")
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, `{"MAINTENANCE_MODE": true}`))
+
+	reloadMaintenanceMode()
+	if !maintenanceMode.Load() {
+		t.Error("maintenance mode not enabled from the config file")
+	}
+
+	t.Setenv("MAINTENANCE_MODE", "not-a-bool")
+	reloadMaintenanceMode()
+	if !maintenanceMode.Load() {
+		t.Error("an invalid value changed the mode")
+	}
+
+	t.Setenv("MAINTENANCE_MODE", "false")
+	reloadMaintenanceMode()
+	if maintenanceMode.Load() {
+		t.Error("maintenance mode not disabled from the environment")
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// errorMessages is the catalog of client-facing error messages, keyed by
+// error code and then language. Every code has an "en" entry, used when
+// the request language has no translation.
+var errorMessages = map[string]map[string]string{
+	"missing_parameter": {
+		"en": "Missing '%s' query parameter",
+		"fr": "Paramètre de requête '%s' manquant",
+	},
+	"missing_field": {
+		"en": "Missing '%s' field",
+		"fr": "Champ '%s' manquant",
+	},
+	"invalid_json": {
+		"en": "Invalid JSON payload",
+		"fr": "Contenu JSON invalide",
+	},
+	"invalid_base64": {
+		"en": "Invalid base64 in '%s' query parameter",
+		"fr": "Base64 invalide dans le paramètre de requête '%s'",
+	},
+	"invalid_count": {
+		"en": "Invalid '%s' query parameter, must be a positive integer",
+		"fr": "Paramètre de requête '%s' invalide, un entier positif est attendu",
+	},
+	"body_too_large": {
+		"en": "Request body too large (max %d bytes)",
+		"fr": "Corps de la requête trop volumineux (%d octets maximum)",
+	},
+	"unreadable_body": {
+		"en": "Failed to read request body",
+		"fr": "Impossible de lire le corps de la requête",
+	},
+	"unsupported_encoding": {
+		"en": "Unsupported encoding '%s'. Use plain or base64",
+		"fr": "Encodage '%s' non pris en charge. Utilisez plain ou base64",
+	},
+	"missing_host_header": {
+		"en": "Missing Host header",
+		"fr": "En-tête Host manquant",
+	},
+	"http_version_not_supported": {
+		"en": "%s is not supported (minimum %s)",
+		"fr": "%s n'est pas pris en charge (minimum %s)",
+	},
+	"unsupported_charset": {
+		"en": "Unsupported charset '%s'",
+		"fr": "Jeu de caractères '%s' non pris en charge",
+	},
+	"record_not_found": {
+		"en": "Record not found",
+		"fr": "Enregistrement introuvable",
+	},
+	"record_name_immutable": {
+		"en": "Record name cannot be changed",
+		"fr": "Le nom de l'enregistrement ne peut pas être modifié",
+	},
+	"job_not_found": {
+		"en": "Job not found",
+		"fr": "Tâche introuvable",
+	},
+	"queue_full": {
+		"en": "Job queue is full, try again later",
+		"fr": "La file de tâches est pleine, réessayez plus tard",
+	},
+	"not_found": {
+		"en": "Not found",
+		"fr": "Introuvable",
+	},
+	"method_not_allowed": {
+		"en": "Method not allowed. Use %s",
+		"fr": "Méthode non autorisée. Utilisez %s",
+	},
+	"connect_not_supported": {
+		"en": "CONNECT is not supported, this server is not a proxy",
+		"fr": "CONNECT n'est pas pris en charge, ce serveur n'est pas un proxy",
+	},
+	"unauthorized": {
+		"en": "Invalid or missing API token",
+		"fr": "Jeton d'API invalide ou manquant",
+	},
+	"too_many_connections": {
+		"en": "Too many connections from your address",
+		"fr": "Trop de connexions depuis votre adresse",
+	},
+	"too_many_uploads": {
+		"en": "Too many uploads in progress, retry later",
+		"fr": "Trop de téléversements en cours, réessayez plus tard",
+	},
+	"rate_limited": {
+		"en": "Too many requests, please slow down",
+		"fr": "Trop de requêtes, veuillez ralentir",
+	},
+	"request_timeout": {
+		"en": "Request timed out after %v",
+		"fr": "La requête a expiré après %v",
+	},
+	"maintenance": {
+		"en": "Service is under maintenance, please try again later",
+		"fr": "Service en maintenance, veuillez réessayer plus tard",
+	},
+	"starting_up": {
+		"en": "Server is starting up, please try again shortly",
+		"fr": "Le serveur démarre, veuillez réessayer dans un instant",
+	},
+	"path_too_long": {
+		"en": "URL path too long (max %d characters)",
+		"fr": "Chemin d'URL trop long (%d caractères maximum)",
+	},
+	"too_many_query_params": {
+		"en": "Too many query parameters (max %d)",
+		"fr": "Trop de paramètres de requête (%d maximum)",
+	},
+	"too_many_headers": {
+		"en": "Too many header fields (max %d)",
+		"fr": "Trop de champs d'en-tête (%d maximum)",
+	},
+	"unsupported_content_encoding": {
+		"en": "Unsupported Content-Encoding '%s'",
+		"fr": "Content-Encoding '%s' non pris en charge",
+	},
+	"malformed_body": {
+		"en": "Malformed %s request body",
+		"fr": "Corps de requête %s mal formé",
+	},
+	"admin_disabled": {
+		"en": "Admin endpoints are disabled",
+		"fr": "Les points d'accès d'administration sont désactivés",
+	},
+	"admin_unauthorized": {
+		"en": "Invalid or missing admin token",
+		"fr": "Jeton d'administration invalide ou manquant",
+	},
+	"invalid_duration": {
+		"en": "Invalid '%s' query parameter, e.g. 30s",
+		"fr": "Paramètre de requête '%s' invalide, par exemple 30s",
+	},
+}
+
+// localize returns the message for code in lang, falling back to English,
+// formatted with args. It returns the language actually used.
+func localize(code, lang string, args ...any) (string, string) {
+	messages := errorMessages[code]
+	format, ok := messages[lang]
+	if !ok {
+		lang = "en"
+		format = messages[lang]
+	}
+	if format == "" {
+		format = code
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(format, args...), lang
+	}
+	return format, lang
+}
+
+// writeLocalizedError writes an ErrorResponse whose message is taken from
+// the catalog in the request's negotiated language
+func writeLocalizedError(w http.ResponseWriter, r *http.Request, status int, code string, args ...any) {
+	message, lang := localize(code, languageFromContext(r.Context()), args...)
+	w.Header().Set("Content-Language", lang)
+	writeJSON(w, status, ErrorResponse{
+		Error:     message,
+		Code:      code,
+		Timestamp: nowFunc(),
+	})
+}
+
+// Made with Bob
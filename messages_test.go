@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLocalizedErrorMessages(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.SupportedLanguages = []string{"en", "fr"}
+		c.DefaultLanguage = "en"
+		c.EchoDefault = ""
+		c.EchoEmptyOK = false
+	})
+	handler := languageMiddleware(jsonHandler(echoHandler))
+
+	tests := []struct {
+		acceptLanguage string
+		wantLang       string
+		wantError      string
+	}{
+		{"fr-FR, en;q=0.5", "fr", "Paramètre de requête 'message' manquant"},
+		{"en", "en", "Missing 'message' query parameter"},
+		{"de", "en", "Missing 'message' query parameter"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler(rec, newRequestWithHeader(http.MethodGet, "/api/echo", "Accept-Language", tt.acceptLanguage))
+
+		var resp ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error != tt.wantError || resp.Code != "missing_parameter" {
+			t.Errorf("Accept-Language %q: error = %q (%s), want %q", tt.acceptLanguage, resp.Error, resp.Code, tt.wantError)
+		}
+		if got := rec.Header().Get("Content-Language"); got != tt.wantLang {
+			t.Errorf("Accept-Language %q: Content-Language = %q, want %q", tt.acceptLanguage, got, tt.wantLang)
+		}
+	}
+}
+
+func TestMessageCatalogHasEnglish(t *testing.T) {
+	for code, messages := range errorMessages {
+		if messages["en"] == "" {
+			t.Errorf("%s has no English message to fall back to", code)
+		}
+	}
+}
+
+func TestMiddlewareErrorsLocalized(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.SupportedLanguages = []string{"en", "fr"}
+		c.DefaultLanguage = "en"
+		c.MaxPathLength = 10
+		c.MaxQueryParams = 1
+		c.MaxHeaders = 2
+		c.RequestEncodings = map[string]bool{"gzip": true}
+	})
+	setAdmin(t, "secret")
+
+	request := func(method, target, body string, header ...string) *http.Request {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Accept-Language", "fr")
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		return req
+	}
+	tests := []struct {
+		handler http.HandlerFunc
+		req     *http.Request
+		status  int
+		code    string
+		message string
+	}{
+		{requestLimitsMiddleware(okHandler), request(http.MethodGet, "/a/very/long/path", ""),
+			http.StatusRequestURITooLong, "path_too_long", "Chemin d'URL trop long (10 caractères maximum)"},
+		{requestLimitsMiddleware(okHandler), request(http.MethodGet, "/?a=1&b=2", ""),
+			http.StatusBadRequest, "too_many_query_params", "Trop de paramètres de requête (1 maximum)"},
+		{requestLimitsMiddleware(okHandler), request(http.MethodGet, "/", "", "X-A", "1", "X-B", "2"),
+			http.StatusBadRequest, "too_many_headers", "Trop de champs d'en-tête (2 maximum)"},
+		{decompressMiddleware(okHandler), request(http.MethodPost, "/", "x", "Content-Encoding", "br"),
+			http.StatusUnsupportedMediaType, "unsupported_content_encoding", "Content-Encoding 'br' non pris en charge"},
+		{decompressMiddleware(okHandler), request(http.MethodPost, "/", "not gzip", "Content-Encoding", "gzip"),
+			http.StatusBadRequest, "malformed_body", "Corps de requête gzip mal formé"},
+		{adminMiddleware(okHandler), request(http.MethodGet, "/admin/flags", ""),
+			http.StatusUnauthorized, "admin_unauthorized", "Jeton d'administration invalide ou manquant"},
+		{readinessFailHandler, request(http.MethodPost, "/admin/readiness/fail?duration=soon", ""),
+			http.StatusBadRequest, "invalid_duration", "Paramètre de requête 'duration' invalide, par exemple 30s"},
+		{setFlagHandler, request(http.MethodPut, "/admin/flags/x", "{"),
+			http.StatusBadRequest, "invalid_json", "Contenu JSON invalide"},
+		{setFlagHandler, request(http.MethodPut, "/admin/flags/x", "{}"),
+			http.StatusBadRequest, "missing_field", "Champ 'enabled' manquant"},
+	}
+	check := func(rec *httptest.ResponseRecorder, status int, code, message string) {
+		t.Helper()
+		var resp ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v: %s", code, err, rec.Body)
+		}
+		if rec.Code != status || resp.Code != code || resp.Error != message {
+			t.Errorf("%d %s %q, want %d %s %q", rec.Code, resp.Code, resp.Error, status, code, message)
+		}
+		if got := rec.Header().Get("Content-Language"); got != "fr" {
+			t.Errorf("%s: Content-Language = %q, want fr", code, got)
+		}
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		languageMiddleware(tt.handler)(rec, tt.req)
+		check(rec, tt.status, tt.code, tt.message)
+	}
+
+	cfg.AdminToken = ""
+	rec := httptest.NewRecorder()
+	languageMiddleware(adminMiddleware(okHandler))(rec, request(http.MethodGet, "/admin/flags", ""))
+	check(rec, http.StatusForbidden, "admin_disabled", "Les points d'accès d'administration sont désactivés")
+}
+
+// Made with Bob
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal Prometheus text-format registry built on the standard library
+
+type collector interface {
+	writeTo(w io.Writer, openMetrics bool)
+}
+
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (reg *Registry) register(c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.collectors = append(reg.collectors, c)
+}
+
+// ServeHTTP exposes all registered metrics in the Prometheus text format,
+// or in OpenMetrics, which adds histogram exemplars, for scrapers that ask for it
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+
+	reg.mu.Lock()
+	collectors := append([]collector(nil), reg.collectors...)
+	reg.mu.Unlock()
+
+	for _, c := range collectors {
+		c.writeTo(w, openMetrics)
+	}
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+}
+
+// CounterVec is a monotonically increasing counter partitioned by labels
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+func (reg *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, series: map[string]*counterSeries{}}
+	reg.register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := seriesKey(labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labelValues: labelValues}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+// Value returns the current count for the given label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.series[seriesKey(labelValues)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *CounterVec) writeTo(w io.Writer, openMetrics bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// OpenMetrics names the family without the _total its samples carry
+	family := c.name
+	if openMetrics {
+		family = strings.TrimSuffix(c.name, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", family, c.help, family)
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, s.labelValues), formatFloat(s.value))
+	}
+}
+
+// HistogramVec tracks value distributions in cumulative buckets, partitioned by labels
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+
+	// Latest exemplar per bucket, the last one for +Inf
+	exemplars []*exemplar
+}
+
+// exemplar links an observation to the request that produced it
+type exemplar struct {
+	labels string
+	value  float64
+	time   time.Time
+}
+
+// Default buckets for request durations in seconds
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default buckets for body sizes in bytes
+var sizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7}
+
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogramSeries{}}
+	reg.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.ObserveWithExemplar(v, "", labelValues...)
+}
+
+// ObserveWithExemplar records v and keeps requestID as the exemplar of the
+// bucket v falls in, so a slow bucket can be traced to a request's log lines
+func (h *HistogramVec) ObserveWithExemplar(v float64, requestID string, labelValues ...string) {
+	key := seriesKey(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: labelValues,
+			counts:      make([]uint64, len(h.buckets)),
+			exemplars:   make([]*exemplar, len(h.buckets)+1),
+		}
+		h.series[key] = s
+	}
+	bucket := len(h.buckets)
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			bucket = min(bucket, i)
+		}
+	}
+	s.sum += v
+	s.count++
+
+	if requestID != "" {
+		s.exemplars[bucket] = &exemplar{
+			labels: formatLabels([]string{"request_id"}, []string{requestID}),
+			value:  v,
+			time:   clock.Now(),
+		}
+	}
+}
+
+// Count returns the number of observations and their sum for the given label values
+func (h *HistogramVec) Count(labelValues ...string) (uint64, float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[seriesKey(labelValues)]; ok {
+		return s.count, s.sum
+	}
+	return 0, 0
+}
+
+func (h *HistogramVec) writeTo(w io.Writer, openMetrics bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, upper := range h.buckets {
+			values := append(append([]string(nil), s.labelValues...), formatFloat(upper))
+			fmt.Fprintf(w, "%s_bucket%s %d%s\n", h.name, formatLabels(bucketLabels, values), s.counts[i],
+				formatExemplar(s.exemplars[i], openMetrics))
+		}
+		values := append(append([]string(nil), s.labelValues...), "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d%s\n", h.name, formatLabels(bucketLabels, values), s.count,
+			formatExemplar(s.exemplars[len(h.buckets)], openMetrics))
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labelValues), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labelValues), s.count)
+	}
+}
+
+// HTTP metrics
+var (
+	metricsRegistry = NewRegistry()
+
+	httpRequestsTotal = metricsRegistry.NewCounterVec(
+		"http_requests_total", "Total HTTP requests by method, route and status.",
+		"method", "route", "status")
+	httpRequestDuration = metricsRegistry.NewHistogramVec(
+		"http_request_duration_seconds", "HTTP request latency in seconds.",
+		durationBuckets, "method", "route")
+	httpRequestSize = metricsRegistry.NewHistogramVec(
+		"http_request_size_bytes", "HTTP request body size in bytes.",
+		sizeBuckets, "route")
+	httpResponseSize = metricsRegistry.NewHistogramVec(
+		"http_response_size_bytes", "HTTP response body size in bytes.",
+		sizeBuckets, "route")
+	jsonEncodeErrorsTotal = metricsRegistry.NewCounterVec(
+		"json_encode_errors_total", "JSON responses that failed to encode, by route.",
+		"route")
+)
+
+// countingReader counts the request body bytes a handler reads
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// metricsMiddleware records request counts, latency and body sizes per route.
+// The route label is the matched pattern such as /api/data/{name}, never the
+// concrete path, and requests no route served share "unmatched". Methods
+// outside the standard set share "other", as clients choose the method, so
+// label cardinality is bounded by the registered routes times the standard
+// methods. Each latency bucket keeps the request ID of its latest
+// observation as an exemplar.
+func metricsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if !cfg.MetricsEnabled {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := clock.Now()
+
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+
+		r, route := captureRoute(r)
+		rec := newStatusRecorder(routeResponseWriter{ResponseWriter: w, route: route})
+		next(rec, r)
+
+		label := routeLabel(*route)
+		method := methodLabel(r.Method)
+
+		httpRequestsTotal.Inc(method, label, strconv.Itoa(rec.status))
+		httpRequestDuration.ObserveWithExemplar(clock.Since(start).Seconds(), rec.Header().Get(cfg.RequestIDHeader), method, label)
+		httpRequestSize.Observe(float64(body.n), label)
+		httpResponseSize.Observe(float64(rec.bytes), label)
+	}
+}
+
+// routeLabel is the route metric label for a matched pattern
+func routeLabel(pattern string) string {
+	if pattern == "" {
+		return "unmatched"
+	}
+	return pattern
+}
+
+// standardMethods are the methods given their own metric label
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// methodLabel is the method metric label, "other" for non-standard methods
+func methodLabel(method string) string {
+	if standardMethods[method] {
+		return method
+	}
+	return "other"
+}
+
+// routeResponseWriter carries the matched route to writeJSON, which only
+// has the ResponseWriter, for json_encode_errors_total
+type routeResponseWriter struct {
+	http.ResponseWriter
+	route *string
+}
+
+func (w routeResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// responseRoute returns the route label for the request w answers
+func responseRoute(w http.ResponseWriter) string {
+	found, ok := findWriter(w, func(w http.ResponseWriter) bool {
+		_, ok := w.(routeResponseWriter)
+		return ok
+	})
+	if !ok {
+		return routeLabel("")
+	}
+	return routeLabel(*found.(routeResponseWriter).route)
+}
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatExemplar renders e as an OpenMetrics bucket suffix; the plain
+// Prometheus text format has no exemplars
+func formatExemplar(e *exemplar, openMetrics bool) string {
+	if e == nil || !openMetrics {
+		return ""
+	}
+	return fmt.Sprintf(" # %s %s %.3f", e.labels, formatFloat(e.value), float64(e.time.UnixMilli())/1000)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Made with Bob
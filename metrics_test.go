@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsRouteLabelIsPattern(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MetricsEnabled = true })
+
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/metrics-test/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := metricsMiddleware(router.ServeHTTP)
+
+	before := httpRequestsTotal.Value(http.MethodGet, "/metrics-test/{name}", "204")
+	for _, name := range []string{"alpha", "beta"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics-test/"+name, nil))
+	}
+
+	if got := httpRequestsTotal.Value(http.MethodGet, "/metrics-test/{name}", "204") - before; got != 2 {
+		t.Errorf("pattern series grew by %v, want 2", got)
+	}
+	for _, name := range []string{"alpha", "beta"} {
+		if got := httpRequestsTotal.Value(http.MethodGet, "/metrics-test/"+name, "204"); got != 0 {
+			t.Errorf("concrete path %q has its own series: %v", name, got)
+		}
+	}
+}
+
+func TestMetricsUnmatchedPathsShareSeries(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MetricsEnabled = true })
+	router := NewRouter()
+	handler := metricsMiddleware(router.ServeHTTP)
+
+	before := httpRequestsTotal.Value(http.MethodGet, "unmatched", "404")
+	for _, path := range []string{"/wp-admin", "/.env", "/random/123"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		if got := httpRequestsTotal.Value(http.MethodGet, path, "404"); got != 0 {
+			t.Errorf("unrouted path %q has its own series: %v", path, got)
+		}
+	}
+	if got := httpRequestsTotal.Value(http.MethodGet, "unmatched", "404") - before; got != 3 {
+		t.Errorf("unmatched series grew by %v, want 3", got)
+	}
+}
+
+func TestJSONEncodeErrorsLabeledByRoute(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MetricsEnabled = true })
+	captureLogs(t)
+
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/broken/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"updates": make(chan struct{})})
+	})
+	handler := metricsMiddleware(router.ServeHTTP)
+
+	before := jsonEncodeErrorsTotal.Value("/broken/{id}")
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/broken/7", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if got := jsonEncodeErrorsTotal.Value("/broken/{id}") - before; got != 1 {
+		t.Errorf("json_encode_errors_total{route=/broken/{id}} grew by %v, want 1", got)
+	}
+}
+
+func TestMetricsMethodLabel(t *testing.T) {
+	tests := map[string]string{
+		http.MethodGet:           http.MethodGet,
+		http.MethodDelete:        http.MethodDelete,
+		http.MethodOptions:       http.MethodOptions,
+		"PROPFIND":               "other",
+		"get":                    "other",
+		strings.Repeat("X", 100): "other",
+	}
+	for method, want := range tests {
+		if got := methodLabel(method); got != want {
+			t.Errorf("methodLabel(%q) = %q, want %q", method, got, want)
+		}
+	}
+}
+
+func TestMetricsNonStandardMethodsShareSeries(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MetricsEnabled = true })
+
+	handler := metricsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	before := httpRequestsTotal.Value("other", "unmatched", "418")
+	for _, method := range []string{"FOO", "BAR"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(method, "/", nil))
+	}
+
+	if got := httpRequestsTotal.Value("other", "unmatched", "418") - before; got != 2 {
+		t.Errorf("other series grew by %v, want 2", got)
+	}
+	if got := httpRequestsTotal.Value("FOO", "unmatched", "418"); got != 0 {
+		t.Errorf("FOO has its own series: %v", got)
+	}
+}
+
+func TestMetricsBodySizes(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MetricsEnabled = true })
+
+	router := NewRouter()
+	router.Handle(http.MethodPost, "/metrics-test/size", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(append(body, body...))
+	})
+	handler := metricsMiddleware(router.ServeHTTP)
+
+	reqCount, reqSum := httpRequestSize.Count("/metrics-test/size")
+	respCount, respSum := httpResponseSize.Count("/metrics-test/size")
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/metrics-test/size", strings.NewReader("twelve bytes")))
+
+	if count, sum := httpRequestSize.Count("/metrics-test/size"); count-reqCount != 1 || sum-reqSum != 12 {
+		t.Errorf("request size grew by %d observations totalling %v, want 1 of 12", count-reqCount, sum-reqSum)
+	}
+	if count, sum := httpResponseSize.Count("/metrics-test/size"); count-respCount != 1 || sum-respSum != 24 {
+		t.Errorf("response size grew by %d observations totalling %v, want 1 of 24", count-respCount, sum-respSum)
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+)
+
+// Middleware wraps a handler with additional behaviour
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// chain wraps h in the given middleware; the first one listed is the outermost
+func chain(h http.HandlerFunc, middleware ...Middleware) http.HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// NamedMiddleware pairs a middleware with the name reported by /admin/middleware
+type NamedMiddleware struct {
+	Name string
+	Wrap Middleware
+}
+
+// middlewareStack is the middleware applied to every request, outermost first
+var middlewareStack []NamedMiddleware
+
+// chainNamed wraps h in the stack, outermost first, like chain
+func chainNamed(h http.HandlerFunc, stack []NamedMiddleware) http.HandlerFunc {
+	middleware := make([]Middleware, len(stack))
+	for i, m := range stack {
+		middleware[i] = m.Wrap
+	}
+	return chain(h, middleware...)
+}
+
+type MiddlewareResponse struct {
+	Middleware []string `json:"middleware"`
+	Timestamp  JSONTime `json:"timestamp"`
+}
+
+// middlewareHandler reports the middleware stack in the order requests pass through it
+func middlewareHandler(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, len(middlewareStack))
+	for i, m := range middlewareStack {
+		names[i] = m.Name
+	}
+	writeJSON(w, http.StatusOK, MiddlewareResponse{
+		Middleware: names,
+		Timestamp:  nowFunc(),
+	})
+}
+
+// customHeadersMiddleware adds the headers configured in CUSTOM_HEADERS to every response
+func customHeadersMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if len(cfg.CustomHeaders) == 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		for name, values := range cfg.CustomHeaders {
+			w.Header()[name] = append([]string(nil), values...)
+		}
+		next(w, r)
+	}
+}
+
+// cacheControl sets the Cache-Control header on every response from the
+// wrapped handler, unless one is already set, such as from CUSTOM_HEADERS;
+// an empty value leaves the header alone
+func cacheControl(value string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if value == "" {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			if w.Header().Get("Cache-Control") == "" {
+				w.Header().Set("Cache-Control", value)
+			}
+			next(w, r)
+		}
+	}
+}
+
+// cacheable marks a rarely-changing response as cacheable per CACHE_CONTROL_CACHEABLE
+func cacheable(h http.HandlerFunc) http.HandlerFunc {
+	return cacheControl(cfg.CacheControlCacheable)(h)
+}
+
+// dynamic marks a response as uncacheable per CACHE_CONTROL_DYNAMIC
+func dynamic(h http.HandlerFunc) http.HandlerFunc {
+	return cacheControl(cfg.CacheControlDynamic)(h)
+}
+
+// statusRecorder wraps a ResponseWriter to capture the status code and bytes written
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController and prettyRequested
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Made with Bob
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCustomHeadersMiddleware(t *testing.T) {
+	logs := captureLogs(t)
+	t.Setenv("CUSTOM_HEADERS", "X-Environment: staging; Cache-Control: no-cache, no-store; not a header; Bad Name: x")
+	setConfig(t, nil)
+
+	rec := httptest.NewRecorder()
+	customHeadersMiddleware(okHandler)(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := rec.Header().Get("X-Environment"); got != "staging" {
+		t.Errorf("X-Environment = %q, want staging", got)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "no-cache, no-store" {
+		t.Errorf("Cache-Control = %q, want no-cache, no-store", got)
+	}
+	if len(cfg.CustomHeaders) != 2 {
+		t.Errorf("CustomHeaders = %v, want only the two valid entries", cfg.CustomHeaders)
+	}
+	for _, entry := range []string{"not a header", "Bad Name: x"} {
+		if !strings.Contains(logs.String(), entry) {
+			t.Errorf("no warning for malformed entry %q: %s", entry, logs)
+		}
+	}
+}
+
+func TestCacheControlPerEndpointClass(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.CacheControlCacheable = "public, max-age=120"
+		c.CacheControlDynamic = "no-store"
+	})
+	router := newAPIRouter(t)
+
+	tests := []struct {
+		method, target, body string
+		want                 string
+	}{
+		{http.MethodGet, "/api/info", "", "public, max-age=120"},
+		{http.MethodGet, "/api/echo?message=hi", "", "no-store"},
+		{http.MethodPost, "/api/data", `{"name":"item"}`, "no-store"},
+		{http.MethodGet, "/api/data/item", "", "no-store"},
+	}
+	for _, tt := range tests {
+		rec := serve(router, tt.method, tt.target, tt.body)
+		if got := rec.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("%s %s: Cache-Control = %q, want %q", tt.method, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestCacheControlKeepsCustomHeader(t *testing.T) {
+	t.Setenv("CUSTOM_HEADERS", "Cache-Control: private, max-age=5")
+	setConfig(t, func(c *Config) {
+		c.CacheControlCacheable = "public, max-age=120"
+		c.CacheControlDynamic = "no-store"
+	})
+	handler := customHeadersMiddleware(newAPIRouter(t).ServeHTTP)
+
+	for _, target := range []string{"/api/info", "/api/echo?message=hi"} {
+		rec := serve(handler, http.MethodGet, target, "")
+		if got := rec.Header().Get("Cache-Control"); got != "private, max-age=5" {
+			t.Errorf("%s: Cache-Control = %q, want the CUSTOM_HEADERS value", target, got)
+		}
+	}
+}
+
+func TestCacheControlEmptyLeavesHeader(t *testing.T) {
+	setConfig(t, func(c *Config) { c.CacheControlCacheable = "" })
+
+	rec := httptest.NewRecorder()
+	cacheable(okHandler)(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("Cache-Control = %q, want it unset", got)
+	}
+}
+
+func TestMiddlewareOrderReported(t *testing.T) {
+	setConfig(t, nil)
+	setAdmin(t, "secret")
+
+	var ran []string
+	named := func(name string) NamedMiddleware {
+		return NamedMiddleware{name, func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				ran = append(ran, name)
+				next(w, r)
+			}
+		}}
+	}
+	saved := middlewareStack
+	middlewareStack = []NamedMiddleware{named("request_id"), named("logging"), named("recovery")}
+	t.Cleanup(func() { middlewareStack = saved })
+
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/admin/middleware", adminMiddleware(middlewareHandler))
+	rec := httptest.NewRecorder()
+	chainNamed(router.ServeHTTP, middlewareStack)(rec, newRequestWithHeader(http.MethodGet, "/admin/middleware", "X-Admin-Token", "secret"))
+
+	var resp MiddlewareResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	want := []string{"request_id", "logging", "recovery"}
+	if !reflect.DeepEqual(resp.Middleware, want) {
+		t.Errorf("reported order = %v, want %v", resp.Middleware, want)
+	}
+	if !reflect.DeepEqual(ran, want) {
+		t.Errorf("requests ran through %v, but %v was reported", ran, want)
+	}
+}
+
+// Made with Bob
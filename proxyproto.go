@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PROXY protocol modes
+const (
+	proxyModeRequire  = "require"  // connections without a header are closed
+	proxyModeOptional = "optional" // connections without a header pass through
+)
+
+// proxyV2Signature opens every PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// A v1 header is at most 107 bytes including the trailing CRLF
+const proxyV1MaxLength = 107
+
+var errMissingProxyHeader = errors.New("connection has no PROXY protocol header")
+
+// proxyListener accepts connections that start with a PROXY protocol v1 or v2
+// header, as sent by AWS NLB or HAProxy, and reports the client address it
+// carries as RemoteAddr
+type proxyListener struct {
+	net.Listener
+	mode    string
+	timeout time.Duration
+}
+
+func newProxyListener(ln net.Listener, mode string, timeout time.Duration) *proxyListener {
+	return &proxyListener{Listener: ln, mode: mode, timeout: timeout}
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{
+		Conn:    conn,
+		reader:  bufio.NewReader(conn),
+		mode:    l.mode,
+		timeout: l.timeout,
+	}, nil
+}
+
+// proxyConn reads the PROXY header on first use rather than in Accept, so a
+// slow client cannot stall the accept loop. Nothing on the accept path may
+// call RemoteAddr, which waits for the header.
+type proxyConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	mode    string
+	timeout time.Duration
+
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) readHeader() {
+	if c.timeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+	}
+
+	first, err := c.reader.Peek(1)
+	if err != nil {
+		c.err = err
+		return
+	}
+
+	switch first[0] {
+	case 'P':
+		c.remoteAddr, c.err = readProxyV1(c.reader)
+	case proxyV2Signature[0]:
+		c.remoteAddr, c.err = readProxyV2(c.reader)
+	default:
+		c.err = errMissingProxyHeader
+	}
+
+	if errors.Is(c.err, errMissingProxyHeader) && c.mode == proxyModeOptional {
+		c.err = nil
+	}
+	if c.err != nil {
+		c.Conn.Close()
+	}
+}
+
+// readProxyV1 parses a text header such as
+// "PROXY TCP4 203.0.113.7 10.0.0.1 51234 8080\r\n".
+// It returns a nil address for PROXY UNKNOWN.
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	if prefix, err := r.Peek(6); err != nil || string(prefix) != "PROXY " {
+		return nil, errMissingProxyHeader
+	}
+
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("PROXY v1 header too long or not terminated by CRLF")
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY v1 header %q", strings.TrimSpace(string(line)))
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("malformed PROXY v1 source address %s:%s", fields[2], fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2 parses a binary header. It returns a nil address for LOCAL
+// commands (health checks from the proxy itself) and non-TCP families.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header, err := r.Peek(16)
+	if err != nil || !bytes.Equal(header[:12], proxyV2Signature) {
+		return nil, errMissingProxyHeader
+	}
+
+	verCmd, family := header[12], header[13]
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", verCmd>>4)
+	}
+
+	if _, err := r.Discard(16); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	if verCmd&0x0f == 0 {
+		return nil, nil
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if length < 12 {
+			return nil, errors.New("short PROXY v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if length < 36 {
+			return nil, errors.New("short PROXY v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+	return nil, nil
+}
+
+// Made with Bob
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProxyV1(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY TCP4 203.0.113.7 10.0.0.1 56324 443\r\nGET / HTTP/1.1\r\n"))
+	addr, err := readProxyV1(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := addr.String(); got != "203.0.113.7:56324" {
+		t.Errorf("address = %s, want 203.0.113.7:56324", got)
+	}
+	if rest, _ := r.ReadString('\n'); rest != "GET / HTTP/1.1\r\n" {
+		t.Errorf("header not fully consumed, next line = %q", rest)
+	}
+
+	if addr, err := readProxyV1(bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n"))); err != nil || addr != nil {
+		t.Errorf("PROXY UNKNOWN = %v, %v; want no address", addr, err)
+	}
+	if _, err := readProxyV1(bufio.NewReader(strings.NewReader("PROXY TCP4 nope 10.0.0.1 1 2\r\n"))); err == nil {
+		t.Error("malformed source address accepted")
+	}
+}
+
+func TestReadProxyV2(t *testing.T) {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x21, 0x11, 0, 12)
+	header = append(header, 203, 0, 113, 7, 10, 0, 0, 1)
+	header = binary.BigEndian.AppendUint16(header, 56324)
+	header = binary.BigEndian.AppendUint16(header, 443)
+
+	addr, err := readProxyV2(bufio.NewReader(strings.NewReader(string(header))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := addr.String(); got != "203.0.113.7:56324" {
+		t.Errorf("address = %s, want 203.0.113.7:56324", got)
+	}
+}
+
+// proxyServer serves the client address through a PROXY protocol listener.
+func proxyServer(t *testing.T, mode string) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.RemoteAddr)
+	}))
+	ts.Listener = newProxyListener(ts.Listener, mode, time.Second)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func rawGet(t *testing.T, addr, preamble string) (string, error) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	io.WriteString(conn, preamble+"GET / HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestProxyListenerUsesHeaderAddress(t *testing.T) {
+	ts := proxyServer(t, proxyModeRequire)
+	got, err := rawGet(t, ts.Listener.Addr().String(), "PROXY TCP4 203.0.113.7 10.0.0.1 56324 443\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "203.0.113.7:56324" {
+		t.Errorf("RemoteAddr = %s, want the PROXY source 203.0.113.7:56324", got)
+	}
+}
+
+func TestProxyListenerRequireRejectsMissingHeader(t *testing.T) {
+	ts := proxyServer(t, proxyModeRequire)
+	if got, err := rawGet(t, ts.Listener.Addr().String(), ""); err == nil {
+		t.Errorf("request without a PROXY header served, RemoteAddr = %s", got)
+	}
+}
+
+func TestProxyListenerOptionalAllowsMissingHeader(t *testing.T) {
+	ts := proxyServer(t, proxyModeOptional)
+	got, err := rawGet(t, ts.Listener.Addr().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "127.0.0.1:") {
+		t.Errorf("RemoteAddr = %s, want the direct peer address", got)
+	}
+}
+
+// Made with Bob
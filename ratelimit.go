@@ -0,0 +1,127 @@
+package main
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Upper bound on tracked (client, route) buckets; the least recently used
+// bucket is evicted to make room, so an evicted client starts over full
+const maxRateLimitKeys = 10000
+
+// RateLimit allows RPS requests per second with bursts of up to Burst.
+// A zero RPS means no limit.
+type RateLimit struct {
+	RPS   int
+	Burst int
+}
+
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.RPS)
+}
+
+// tokenBucket holds the tokens left for one client on one route
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per client IP and route, at most
+// maxKeys of them, in least recently used order
+type rateLimiter struct {
+	mu      sync.Mutex
+	maxKeys int
+	buckets map[string]*list.Element
+	lru     *list.List // of *tokenBucket, most recently used first
+}
+
+func newRateLimiter(maxKeys int) *rateLimiter {
+	return &rateLimiter{maxKeys: maxKeys, buckets: make(map[string]*list.Element), lru: list.New()}
+}
+
+var routeRateLimiter = newRateLimiter(maxRateLimitKeys)
+
+// rateLimitDecision is the outcome of one Allow call
+type rateLimitDecision struct {
+	Allowed    bool
+	Limit      int           // bucket size
+	Remaining  int           // whole tokens left after this request
+	RetryAfter time.Duration // until the next token, when not allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// Allow takes a token from key's bucket if one is left
+func (rl *rateLimiter) Allow(key string, limit RateLimit) rateLimitDecision {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := clock.Now()
+	var b *tokenBucket
+	if elem, ok := rl.buckets[key]; ok {
+		rl.lru.MoveToFront(elem)
+		b = elem.Value.(*tokenBucket)
+	} else {
+		if rl.lru.Len() >= rl.maxKeys {
+			oldest := rl.lru.Back()
+			delete(rl.buckets, oldest.Value.(*tokenBucket).key)
+			rl.lru.Remove(oldest)
+		}
+		b = &tokenBucket{key: key, tokens: limit.burst(), last: now}
+		rl.buckets[key] = rl.lru.PushFront(b)
+	}
+
+	rate := float64(limit.RPS)
+	b.tokens = math.Min(limit.burst(), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	d := rateLimitDecision{Allowed: b.tokens >= 1, Limit: int(limit.burst())}
+	if d.Allowed {
+		b.tokens--
+	} else {
+		d.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = time.Duration((limit.burst() - b.tokens) / rate * float64(time.Second))
+	return d
+}
+
+// rateLimitKey identifies a client on a route, so a busy route does not
+// use up a client's allowance for the others. Routes are keyed by their
+// unversioned pattern, so /api/data, /v1/api/data and /v2/api/data share
+// one allowance.
+func rateLimitKey(r *http.Request, rte *route) string {
+	client := r.RemoteAddr
+	if ip, ok := remoteIP(r.RemoteAddr); ok {
+		client = ip.String()
+	}
+	return client + " " + rte.method + " " + rte.canonical
+}
+
+// setRateLimitHeaders tells clients their allowance so they can slow down
+// before reaching 429
+func setRateLimitHeaders(w http.ResponseWriter, d rateLimitDecision) {
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+}
+
+// rateLimited answers 429 with Retry-After
+func rateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	setRetryAfter(w, retryAfter)
+	writeLocalizedError(w, r, http.StatusTooManyRequests, "rate_limited")
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Made with Bob
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// setRateLimiter gives the test a fresh set of rate-limit buckets
+func setRateLimiter(t *testing.T) {
+	t.Helper()
+	saved := routeRateLimiter
+	routeRateLimiter = newRateLimiter(maxRateLimitKeys)
+	t.Cleanup(func() { routeRateLimiter = saved })
+}
+
+func TestRateLimiterEvictsLeastRecentlyUsed(t *testing.T) {
+	rl := newRateLimiter(2)
+	limit := RateLimit{RPS: 1, Burst: 1}
+
+	rl.Allow("a", limit)
+	rl.Allow("b", limit)
+	rl.Allow("a", limit) // a is now more recently used than b
+	rl.Allow("c", limit) // evicts b
+
+	if got := len(rl.buckets); got != 2 {
+		t.Fatalf("tracking %d buckets, want 2", got)
+	}
+	if _, ok := rl.buckets["b"]; ok {
+		t.Error("least recently used bucket b was not evicted")
+	}
+	if d := rl.Allow("a", limit); d.Allowed {
+		t.Error("bucket a was reset by eviction")
+	}
+	if d := rl.Allow("b", limit); !d.Allowed {
+		t.Error("evicted bucket b did not start over full")
+	}
+}
+
+func TestRateLimitSharedAcrossVersions(t *testing.T) {
+	setConfig(t, nil)
+	setRateLimiter(t)
+
+	router := NewRouter()
+	router.RateLimit = RateLimit{RPS: 1, Burst: 2}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	router.Handle(http.MethodGet, "/api/limited", ok)
+	router.Group("/v1", func(g *RouteGroup) { g.Handle(http.MethodGet, "/api/limited", ok) })
+	router.Group("/v2", func(g *RouteGroup) { g.Handle(http.MethodGet, "/api/limited", ok) })
+
+	var statuses []int
+	for _, path := range []string{"/api/limited", "/v1/api/limited", "/v2/api/limited"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		statuses = append(statuses, rec.Code)
+	}
+
+	want := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Fatalf("statuses = %v, want %v", statuses, want)
+		}
+	}
+}
+
+func TestPerRouteRateLimit(t *testing.T) {
+	setConfig(t, nil)
+	setRateLimiter(t)
+	setClock(t, newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	router := NewRouter()
+	router.RateLimit = RateLimit{RPS: 1, Burst: 5}
+	router.Handle(http.MethodPost, "/api/data", okHandler, WithRateLimit(RateLimit{RPS: 1, Burst: 2}))
+	router.Handle(http.MethodGet, "/api/echo", okHandler)
+
+	send := func(method, path, remoteAddr string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	var dataThrottledAt, echoThrottledAt int
+	for i := 1; i <= 6; i++ {
+		if dataThrottledAt == 0 && send(http.MethodPost, "/api/data", "192.0.2.1:1000") == http.StatusTooManyRequests {
+			dataThrottledAt = i
+		}
+		if echoThrottledAt == 0 && send(http.MethodGet, "/api/echo", "192.0.2.1:1000") == http.StatusTooManyRequests {
+			echoThrottledAt = i
+		}
+	}
+	if dataThrottledAt != 3 {
+		t.Errorf("tight route throttled at request %d, want 3", dataThrottledAt)
+	}
+	if echoThrottledAt != 6 {
+		t.Errorf("route on the global limit throttled at request %d, want 6", echoThrottledAt)
+	}
+
+	// Another client has its own allowance on the tight route
+	if got := send(http.MethodPost, "/api/data", "192.0.2.2:1000"); got != http.StatusOK {
+		t.Errorf("second client: status = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestRateLimitHeadersDecrement(t *testing.T) {
+	setConfig(t, func(c *Config) { c.RateLimitHeaders = true })
+	setRateLimiter(t)
+	setClock(t, newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	router := NewRouter()
+	router.RateLimit = RateLimit{RPS: 1, Burst: 3}
+	router.Handle(http.MethodGet, "/api/echo", okHandler)
+
+	tests := []struct {
+		status           int
+		remaining, reset string
+	}{
+		{http.StatusOK, "2", "1"},
+		{http.StatusOK, "1", "2"},
+		{http.StatusOK, "0", "3"},
+		{http.StatusTooManyRequests, "0", "3"},
+	}
+	for i, tt := range tests {
+		rec := serve(router, http.MethodGet, "/api/echo", "")
+		h := rec.Header()
+		if rec.Code != tt.status || h.Get("X-RateLimit-Limit") != "3" ||
+			h.Get("X-RateLimit-Remaining") != tt.remaining || h.Get("X-RateLimit-Reset") != tt.reset {
+			t.Errorf("request %d: status %d, limit %q, remaining %q, reset %q; want %d, 3, %s, %s",
+				i+1, rec.Code, h.Get("X-RateLimit-Limit"), h.Get("X-RateLimit-Remaining"), h.Get("X-RateLimit-Reset"),
+				tt.status, tt.remaining, tt.reset)
+		}
+	}
+}
+
+func TestRateLimitHeadersDisabled(t *testing.T) {
+	setConfig(t, func(c *Config) { c.RateLimitHeaders = false })
+	setRateLimiter(t)
+
+	router := NewRouter()
+	router.RateLimit = RateLimit{RPS: 1, Burst: 3}
+	router.Handle(http.MethodGet, "/api/echo", okHandler)
+	if got := serve(router, http.MethodGet, "/api/echo", "").Header().Get("X-RateLimit-Limit"); got != "" {
+		t.Errorf("X-RateLimit-Limit = %q, want it unset", got)
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// recoveryMiddleware turns handler panics into 500 responses. With
+// PANIC_MODE=crash the panic is logged and then re-raised so the process dies.
+func recoveryMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			slog.Error("Panic while serving request",
+				"error", fmt.Sprint(v),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"request_id", requestIDFromContext(r.Context()),
+				"stack", string(debug.Stack()),
+			)
+
+			if strings.ToLower(cfg.PanicMode) == "crash" {
+				// net/http recovers panics on the serving goroutine, so re-panic
+				// on a fresh one to take the process down
+				go panic(v)
+				select {}
+			}
+
+			writeJSON(w, http.StatusInternalServerError, internalErrorResponse(fmt.Errorf("panic: %v", v)))
+		}()
+
+		next(w, r)
+	}
+}
+
+// Made with Bob
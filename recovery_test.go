@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func panicHandler(w http.ResponseWriter, r *http.Request) {
+	panic("handler exploded")
+}
+
+func TestRecoverModeReturns500(t *testing.T) {
+	setConfig(t, func(c *Config) { c.PanicMode = "recover" })
+	logs := captureLogs(t)
+
+	rec := httptest.NewRecorder()
+	recoveryMiddleware(panicHandler)(rec, httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(logs.String(), "handler exploded") {
+		t.Errorf("panic not logged: %s", logs)
+	}
+}
+
+func TestCrashModeExits(t *testing.T) {
+	// The crash re-panics on a new goroutine, which ends the process, so the
+	// request is served in a child running just this test
+	if os.Getenv("PANIC_MODE_CHILD") == "1" {
+		setConfig(t, func(c *Config) { c.PanicMode = "crash" })
+		recoveryMiddleware(panicHandler)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/boom", nil))
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrashModeExits$")
+	cmd.Env = append(os.Environ(), "PANIC_MODE_CHILD=1")
+	out, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Success() {
+		t.Fatalf("child did not crash: %v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "panic: handler exploded") {
+		t.Errorf("child output lacks the re-raised panic:\n%s", out)
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Largest request body kept for /admin/replay; bigger requests are not replayed
+const maxReplayBodyBytes = 64 << 10
+
+// replayingKey marks requests sent by /admin/replay, which are not recorded
+const replayingKey contextKey = "replaying"
+
+// isReplay reports whether r was sent by /admin/replay
+func isReplay(r *http.Request) bool {
+	replaying, _ := r.Context().Value(replayingKey).(bool)
+	return replaying
+}
+
+// replayRequest is what /admin/replay needs to send a recorded request again.
+// Sensitive headers are dropped before it is stored.
+type replayRequest struct {
+	rawQuery  string
+	header    http.Header
+	body      []byte
+	truncated bool
+	unread    bool // the handler did not read the whole body
+}
+
+// replayHeaders copies h without credentials, which must not be replayed
+func replayHeaders(h http.Header) http.Header {
+	header := make(http.Header, len(h))
+	for name, values := range h {
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		header[name] = append([]string(nil), values...)
+	}
+	return header
+}
+
+// bodyCapture keeps the first maxReplayBodyBytes of a request body as the
+// handler reads it
+type bodyCapture struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	truncated bool
+	eof       bool
+}
+
+func (c *bodyCapture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if room := maxReplayBodyBytes - c.buf.Len(); n > room {
+		c.buf.Write(p[:room])
+		c.truncated = true
+	} else {
+		c.buf.Write(p[:n])
+	}
+	if err == io.EOF {
+		c.eof = true
+	}
+	return n, err
+}
+
+// captureForReplay starts recording r for /admin/replay and returns a
+// function that completes the record once the handler has run
+func captureForReplay(r *http.Request) func() *replayRequest {
+	replay := &replayRequest{rawQuery: r.URL.RawQuery, header: replayHeaders(r.Header)}
+	if r.Body == nil || r.Body == http.NoBody {
+		return func() *replayRequest { return replay }
+	}
+
+	capture := &bodyCapture{ReadCloser: r.Body}
+	r.Body = capture
+	return func() *replayRequest {
+		replay.body = capture.buf.Bytes()
+		replay.truncated = capture.truncated
+		replay.unread = !capture.eof
+		return replay
+	}
+}
+
+type ReplayResult struct {
+	Method         string `json:"method"`
+	Path           string `json:"path"`
+	OriginalStatus int    `json:"original_status"`
+	Status         int    `json:"status,omitempty"`
+	Skipped        string `json:"skipped,omitempty"`
+}
+
+type ReplayResponse struct {
+	Count     int            `json:"count"`
+	Results   []ReplayResult `json:"results"`
+	Timestamp JSONTime       `json:"timestamp"`
+}
+
+// replayHandler sends the last ?count= recorded requests (all by default)
+// through the middleware stack and router again, oldest first, and reports
+// the statuses they get now. Replays pass auth, limits, rate limiting and
+// decompression like the originals but are not recorded themselves. Admin
+// requests, oversized bodies and bodies the original request was rejected
+// before reading are skipped.
+func replayHandler(router *Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requests := recentRequests.Snapshot()
+		if raw := r.URL.Query().Get("count"); raw != "" {
+			count, err := strconv.Atoi(raw)
+			if err != nil || count <= 0 {
+				writeLocalizedError(w, r, http.StatusBadRequest, "invalid_count", "count")
+				return
+			}
+			if count < len(requests) {
+				requests = requests[:count]
+			}
+		}
+
+		// Built per call, as the stack is assembled after routes are registered
+		h := chainNamed(router.ServeHTTP, middlewareStack)
+		results := make([]ReplayResult, 0, len(requests))
+		for i := len(requests) - 1; i >= 0; i-- {
+			if r.Context().Err() != nil {
+				return
+			}
+			results = append(results, replayOne(h, r, requests[i]))
+		}
+
+		log.Printf("Chaos: replayed %d recorded requests", len(results))
+
+		writeJSON(w, http.StatusOK, ReplayResponse{
+			Count:     len(results),
+			Results:   results,
+			Timestamp: nowFunc(),
+		})
+	}
+}
+
+func replayOne(h http.HandlerFunc, admin *http.Request, recorded RecentRequest) ReplayResult {
+	result := ReplayResult{Method: recorded.Method, Path: recorded.Path, OriginalStatus: recorded.Status}
+	switch {
+	case recorded.replay == nil:
+		result.Skipped = "not captured"
+		return result
+	case recorded.Path == "/admin" || strings.HasPrefix(recorded.Path, "/admin/"):
+		result.Skipped = "admin request"
+		return result
+	case recorded.replay.truncated:
+		result.Skipped = "body too large"
+		return result
+	case recorded.replay.unread:
+		// Rejected before the body was read, so it was never captured
+		result.Skipped = "body not read"
+		return result
+	}
+
+	target := recorded.Path
+	if recorded.replay.rawQuery != "" {
+		target += "?" + recorded.replay.rawQuery
+	}
+	ctx := context.WithValue(admin.Context(), replayingKey, true)
+	req, err := http.NewRequestWithContext(ctx, recorded.Method, target, bytes.NewReader(recorded.replay.body))
+	if err != nil {
+		result.Skipped = err.Error()
+		return result
+	}
+	req.Header = recorded.replay.header.Clone()
+	req.Host = admin.Host
+	req.RemoteAddr = admin.RemoteAddr
+
+	rec := newStatusRecorder(&discardResponseWriter{header: make(http.Header)})
+	h(rec, req)
+	result.Status = rec.status
+	return result
+}
+
+// discardResponseWriter throws a replayed response away
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+// Made with Bob
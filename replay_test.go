@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReplayRecordedRequest(t *testing.T) {
+	setConfig(t, func(c *Config) { c.ChaosEnabled = true })
+	setAdmin(t, "secret")
+	setRecentRequests(t, 10)
+	captureLogs(t)
+	saved := middlewareStack
+	middlewareStack = []NamedMiddleware{{"recent_requests", recentRequestsMiddleware}}
+	t.Cleanup(func() { middlewareStack = saved })
+
+	type seenRequest struct {
+		body, auth, trace string
+	}
+	var seen []seenRequest
+	router := NewRouter()
+	router.Handle(http.MethodPost, "/api/data", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen = append(seen, seenRequest{string(body), r.Header.Get("Authorization"), r.Header.Get("X-Trace")})
+		w.WriteHeader(http.StatusCreated)
+	})
+	router.Handle(http.MethodPost, "/admin/replay", adminMiddleware(replayHandler(router)))
+	handler := chainNamed(router.ServeHTTP, middlewareStack)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/data", strings.NewReader(`{"name":"a"}`))
+	req.Header.Set("Authorization", "Bearer user-token")
+	req.Header.Set("X-Trace", "t-1")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("original: status = %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, newRequestWithHeader(http.MethodPost, "/admin/replay", "X-Admin-Token", "secret"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("replay: status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp ReplayResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 1 || resp.Results[0].Status != http.StatusCreated || resp.Results[0].OriginalStatus != http.StatusCreated {
+		t.Fatalf("results = %+v, want the POST replayed with 201", resp.Results)
+	}
+
+	if len(seen) != 2 {
+		t.Fatalf("handler ran %d times, want 2", len(seen))
+	}
+	replayed := seen[1]
+	if replayed.body != `{"name":"a"}` || replayed.trace != "t-1" {
+		t.Errorf("replayed request = %+v, want the original body and headers", replayed)
+	}
+	if replayed.auth != "" {
+		t.Errorf("Authorization replayed verbatim: %q", replayed.auth)
+	}
+
+	// The replay itself is not recorded, only the admin call that asked for it
+	if got := len(recentRequests.Snapshot()); got != 2 {
+		t.Errorf("recorded %d requests, want the original and the admin call", got)
+	}
+}
+
+// Made with Bob
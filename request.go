@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// contextReader stops reading once the request context is cancelled,
+// e.g. when the client disconnects mid-upload
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// Size of the pooled buffers used to read request bodies
+const bodyReaderSize = 32 << 10
+
+// bodyReaders recycles body read buffers across requests to cut allocations
+// when decoding large payloads under load
+var bodyReaders = sync.Pool{
+	New: func() any { return bufio.NewReaderSize(nil, bodyReaderSize) },
+}
+
+// decodeJSONBody decodes the request body into v, aborting if the request is cancelled
+func decodeJSONBody(r *http.Request, v interface{}) error {
+	br := bodyReaders.Get().(*bufio.Reader)
+	br.Reset(contextReader{ctx: r.Context(), r: r.Body})
+	defer func() {
+		br.Reset(nil)
+		bodyReaders.Put(br)
+	}()
+
+	return json.NewDecoder(br).Decode(v)
+}
+
+// requestCancelled reports whether the request is over, because the client
+// went away or the handler ran past its timeout, logging which. Handlers
+// use it to skip writing a response nobody will read.
+func requestCancelled(r *http.Request) bool {
+	switch err := r.Context().Err(); {
+	case errors.Is(err, context.DeadlineExceeded):
+		slog.Info("Request abandoned after handler timeout", "method", r.Method, "path", r.URL.Path)
+		return true
+	case err != nil:
+		slog.Debug("Request cancelled by client", "method", r.Method, "path", r.URL.Path, "error", err)
+		return true
+	}
+	return false
+}
+
+// drainBody reads what the handler left of the request body, up to
+// DRAIN_BODY_MAX_BYTES, so the connection can be reused for the next
+// request. Larger remainders are left for net/http, which closes the
+// connection instead. Requests that were cancelled or timed out are not
+// drained, as nobody is waiting for the connection.
+func drainBody(next http.HandlerFunc) http.HandlerFunc {
+	if cfg.DrainBodyMaxBytes <= 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r)
+
+		if r.Body == nil || r.Body == http.NoBody || r.Context().Err() != nil {
+			return
+		}
+		if _, err := io.CopyN(io.Discard, r.Body, int64(cfg.DrainBodyMaxBytes)); err != nil && err != io.EOF {
+			slog.Debug("Could not drain request body", "method", r.Method, "path", r.URL.Path, "error", err)
+		}
+		r.Body.Close()
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// cancellingReader hands out part of a body, then cancels the request as a
+// client disconnecting mid-upload would
+type cancellingReader struct {
+	chunk  []byte
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (cr *cancellingReader) Read(p []byte) (int, error) {
+	cr.reads++
+	if cr.reads > 1 {
+		panic("body read after the request was cancelled")
+	}
+	cr.cancel()
+	return copy(p, cr.chunk), nil
+}
+
+func TestDataHandlerAbortsOnCancel(t *testing.T) {
+	setConfig(t, nil)
+	newAPIRouter(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	body := &cancellingReader{chunk: []byte(`{"name":"slow","value":"`), cancel: cancel}
+	req := httptest.NewRequest(http.MethodPost, "/api/data", body).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	status, resp, err := dataHandler(req)
+	if err != errRequestCancelled {
+		t.Fatalf("dataHandler = %d, %v, %v; want errRequestCancelled", status, resp, err)
+	}
+	if _, ok := dataStore.Get("slow"); ok {
+		t.Error("cancelled request was stored")
+	}
+
+	rec := httptest.NewRecorder()
+	jsonHandler(dataHandler)(rec, req)
+	if rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "" {
+		t.Errorf("response written to a cancelled request: %d %s", rec.Code, rec.Body)
+	}
+}
+
+// largeDataBody is a batch-sized JSON payload for the decode benchmarks
+var largeDataBody = []byte(`{"name":"bulk","value":"` + strings.Repeat("x", 256<<10) + `"}`)
+
+func benchmarkDecode(b *testing.B, decode func(r *http.Request, v interface{}) error) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(largeDataBody)))
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/data", bytes.NewReader(largeDataBody))
+		var data DataRequest
+		if err := decode(req, &data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeJSONBody measures decoding through the pooled body reader;
+// compare allocations with BenchmarkDecodeJSONBodyUnpooled
+func BenchmarkDecodeJSONBody(b *testing.B) {
+	benchmarkDecode(b, decodeJSONBody)
+}
+
+// BenchmarkDecodeJSONBodyUnpooled decodes the same way but with a fresh
+// buffered reader per request, as before the pool
+func BenchmarkDecodeJSONBodyUnpooled(b *testing.B) {
+	benchmarkDecode(b, func(r *http.Request, v interface{}) error {
+		br := bufio.NewReaderSize(contextReader{ctx: r.Context(), r: r.Body}, bodyReaderSize)
+		return json.NewDecoder(br).Decode(v)
+	})
+}
+
+// trackedBody records how much of a request body was read and whether it was closed
+type trackedBody struct {
+	io.Reader
+	read   int
+	closed bool
+}
+
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.read += n
+	return n, err
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestDrainBodyAfterEarlyReturn(t *testing.T) {
+	setConfig(t, func(c *Config) { c.DrainBodyMaxBytes = 1024 })
+	rejectEarly := drainBody(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	tests := []struct {
+		size, wantRead int
+	}{
+		{512, 512},
+		{4096, 1024},
+	}
+	for _, tt := range tests {
+		body := &trackedBody{Reader: strings.NewReader(strings.Repeat("x", tt.size))}
+		req := httptest.NewRequest(http.MethodPost, "/api/data", nil)
+		req.Body = body
+		rejectEarly(httptest.NewRecorder(), req)
+
+		if body.read != tt.wantRead {
+			t.Errorf("%d-byte body: drained %d bytes, want %d", tt.size, body.read, tt.wantRead)
+		}
+		if !body.closed {
+			t.Errorf("%d-byte body was not closed", tt.size)
+		}
+	}
+}
+
+func TestDrainBodySkipsCancelledRequests(t *testing.T) {
+	setConfig(t, func(c *Config) { c.DrainBodyMaxBytes = 1024 })
+	ctx, cancel := context.WithCancel(context.Background())
+	body := &trackedBody{Reader: strings.NewReader("unread")}
+	req := httptest.NewRequest(http.MethodPost, "/api/data", nil).WithContext(ctx)
+	req.Body = body
+
+	drainBody(func(w http.ResponseWriter, r *http.Request) { cancel() })(httptest.NewRecorder(), req)
+	if body.read != 0 {
+		t.Errorf("drained %d bytes of a cancelled request, want none", body.read)
+	}
+}
+
+// Made with Bob
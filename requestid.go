@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+const requestIDKey contextKey = "requestID"
+
+// Maximum accepted length of a client-supplied request ID
+const maxRequestIDLength = 128
+
+// requestIDMiddleware reuses a well-formed incoming request ID or generates one,
+// echoing it on the response under REQUEST_ID_HEADER and storing it in the request context
+func requestIDMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(cfg.RequestIDHeader)
+		if !validRequestID(id) {
+			id = randomHex(16)
+		}
+
+		w.Header().Set(cfg.RequestIDHeader, id)
+		next(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	}
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Made with Bob
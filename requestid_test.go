@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDCustomHeader(t *testing.T) {
+	t.Setenv("REQUEST_ID_HEADER", "X-Correlation-ID")
+	setConfig(t, nil)
+
+	var seen string
+	handler := requestIDMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFromContext(r.Context())
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, newRequestWithHeader(http.MethodGet, "/", "X-Correlation-ID", "corr-123"))
+	if seen != "corr-123" {
+		t.Errorf("request ID in context = %q, want the incoming X-Correlation-ID", seen)
+	}
+	if got := rec.Header().Get("X-Correlation-ID"); got != "corr-123" {
+		t.Errorf("X-Correlation-ID = %q, want corr-123", got)
+	}
+	if got := rec.Header().Get("X-Request-ID"); got != "" {
+		t.Errorf("X-Request-ID = %q, want it unset with a custom header name", got)
+	}
+
+	// The default header name is no longer read
+	rec = httptest.NewRecorder()
+	handler(rec, newRequestWithHeader(http.MethodGet, "/", "X-Request-ID", "ignored"))
+	if seen == "ignored" || rec.Header().Get("X-Correlation-ID") != seen {
+		t.Errorf("request ID = %q, want a generated ID sent as X-Correlation-ID", seen)
+	}
+}
+
+func TestRequestIDDefaultHeader(t *testing.T) {
+	t.Setenv("REQUEST_ID_HEADER", "")
+	setConfig(t, nil)
+	if cfg.RequestIDHeader != "X-Request-ID" {
+		t.Errorf("default header = %q, want X-Request-ID", cfg.RequestIDHeader)
+	}
+}
+
+func TestRequestIDCorrelatesLogMetricsAndContext(t *testing.T) {
+	setConfig(t, func(c *Config) { c.MetricsEnabled = true })
+	logs := &logBuffer{}
+	setLogger(t, slog.New(slog.NewJSONHandler(logs, nil)))
+
+	var inContext string
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/correlate", func(w http.ResponseWriter, r *http.Request) {
+		inContext = requestIDFromContext(r.Context())
+	})
+	handler := chain(router.ServeHTTP, metricsMiddleware, requestIDMiddleware, loggingMiddleware)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/correlate", nil))
+	id := rec.Header().Get(cfg.RequestIDHeader)
+	if id == "" || inContext != id {
+		t.Fatalf("context ID %q, response header %q; want one generated ID", inContext, id)
+	}
+
+	if !strings.Contains(logs.String(), "request_id="+id) {
+		t.Errorf("access log does not carry request_id %q:\n%s", id, logs)
+	}
+
+	scrape := httptest.NewRecorder()
+	metricsRegistry.ServeHTTP(scrape, newRequestWithHeader(http.MethodGet, "/metrics", "Accept", "application/openmetrics-text"))
+	exemplar := false
+	for _, line := range strings.Split(scrape.Body.String(), "\n") {
+		if strings.HasPrefix(line, "http_request_duration_seconds_bucket") && strings.Contains(line, `route="/correlate"`) &&
+			strings.Contains(line, `# {request_id="`+id+`"}`) {
+			exemplar = true
+		}
+	}
+	if !exemplar {
+		t.Errorf("no /correlate duration exemplar with request_id %q", id)
+	}
+
+	// With LOG_FIELDS the ID is a structured field
+	cfg.LogFields = []string{"path", "request_id"}
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/correlate", nil))
+	var logged struct {
+		Msg       string `json:"msg"`
+		RequestID string `json:"request_id"`
+	}
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &logged); err != nil {
+		t.Fatal(err)
+	}
+	if want := rec.Header().Get(cfg.RequestIDHeader); logged.Msg != "request" || logged.RequestID != want || want != inContext {
+		t.Errorf("access log request_id = %q, context %q, header %q; want them equal", logged.RequestID, inContext, want)
+	}
+}
+
+// Made with Bob
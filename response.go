@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Envelope shapes used when ENVELOPE_RESPONSES is enabled
+type ResponseMeta struct {
+	RequestID string   `json:"request_id,omitempty"`
+	Timestamp JSONTime `json:"timestamp"`
+}
+
+type DataEnvelope struct {
+	Data interface{}  `json:"data"`
+	Meta ResponseMeta `json:"meta"`
+}
+
+type ErrorEnvelope struct {
+	Error interface{}  `json:"error"`
+	Meta  ResponseMeta `json:"meta"`
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+// The body is encoded before anything is sent, so an encoding failure
+// becomes a clean 500 instead of a truncated response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := encodeJSON(w, status, v)
+	if err != nil {
+		route := responseRoute(w)
+		slog.Error("Failed to encode response", "error", err, "status", status, "route", route)
+		jsonEncodeErrorsTotal.Inc(route)
+		status = http.StatusInternalServerError
+		body, err = encodeJSON(w, status, internalErrorResponse(err))
+		if err != nil {
+			http.Error(w, "Internal server error", status)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if cfg.AddBodyChecksum {
+		sum := sha256.Sum256(body)
+		w.Header().Set("X-Content-SHA256", hex.EncodeToString(sum[:]))
+	}
+	w.WriteHeader(status)
+
+	if _, err := w.Write(body); err != nil {
+		if isClientDisconnect(err) {
+			slog.Debug("Client disconnected before response was written", "error", err)
+			return
+		}
+		slog.Error("Failed to write response", "error", err)
+	}
+}
+
+// encodeJSON applies the field case, any ?fields= selection and the
+// configured envelope to v and encodes it
+func encodeJSON(w http.ResponseWriter, status int, v interface{}) ([]byte, error) {
+	v = applyFieldCase(v)
+	if fields := requestedFields(w); fields != nil && status < http.StatusBadRequest {
+		filtered, err := filterFields(v, fields)
+		if err != nil {
+			return nil, err
+		}
+		v = filtered
+	}
+	if cfg.EnvelopeResponses {
+		v = applyFieldCase(envelope(w, status, v))
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if prettyRequested(w) {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// prettyResponseWriter marks a response whose JSON should be indented
+type prettyResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w prettyResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// prettyMiddleware indents JSON responses, success and error alike, when
+// PRETTY_JSON is set or the request has ?pretty=true (?pretty=false opts out)
+func prettyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pretty := cfg.PrettyJSON
+		if raw := r.URL.Query().Get("pretty"); raw != "" {
+			if parsed, err := strconv.ParseBool(raw); err == nil {
+				pretty = parsed
+			}
+		}
+		if pretty {
+			w = prettyResponseWriter{w}
+		}
+		next(w, r)
+	}
+}
+
+// prettyRequested reports whether w, or a writer it wraps, is a prettyResponseWriter
+func prettyRequested(w http.ResponseWriter) bool {
+	_, ok := findWriter(w, func(w http.ResponseWriter) bool {
+		_, ok := w.(prettyResponseWriter)
+		return ok
+	})
+	return ok
+}
+
+// fieldsResponseWriter carries a ?fields= selection to writeJSON
+type fieldsResponseWriter struct {
+	http.ResponseWriter
+	fields map[string]bool
+}
+
+func (w fieldsResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// fieldsMiddleware lets clients select top-level response fields with
+// ?fields=a,b. Error responses are never filtered.
+func fieldsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw := r.URL.Query().Get("fields")
+		if raw == "" {
+			next(w, r)
+			return
+		}
+
+		fields := make(map[string]bool)
+		for _, name := range strings.Split(raw, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				fields[name] = true
+			}
+		}
+		next(fieldsResponseWriter{ResponseWriter: w, fields: fields}, r)
+	}
+}
+
+// requestedFields returns the ?fields= selection for w, or nil if there is none
+func requestedFields(w http.ResponseWriter) map[string]bool {
+	found, ok := findWriter(w, func(w http.ResponseWriter) bool {
+		_, ok := w.(fieldsResponseWriter)
+		return ok
+	})
+	if !ok {
+		return nil
+	}
+	return found.(fieldsResponseWriter).fields
+}
+
+// filterFields keeps only the selected top-level keys of v's JSON object.
+// Values that do not encode to an object are returned unchanged.
+func filterFields(v interface{}, fields map[string]bool) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return v, nil
+	}
+	for key := range object {
+		if !fields[key] {
+			delete(object, key)
+		}
+	}
+	return object, nil
+}
+
+// findWriter walks w and the writers it wraps via Unwrap, returning the first that matches
+func findWriter(w http.ResponseWriter, match func(http.ResponseWriter) bool) (http.ResponseWriter, bool) {
+	for {
+		if match(w) {
+			return w, true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil, false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// envelope wraps v as {"data": ...} or, for error statuses, {"error": ...}
+func envelope(w http.ResponseWriter, status int, v interface{}) interface{} {
+	meta := ResponseMeta{
+		RequestID: w.Header().Get(cfg.RequestIDHeader),
+		Timestamp: nowFunc(),
+	}
+	if status >= http.StatusBadRequest {
+		return ErrorEnvelope{Error: v, Meta: meta}
+	}
+	return DataEnvelope{Data: v, Meta: meta}
+}
+
+// setRetryAfter sets Retry-After to base plus a random jitter of up to
+// RETRY_AFTER_JITTER, rounded up to whole seconds and at least 1, so clients
+// turned away together do not all come back at the same instant
+func setRetryAfter(w http.ResponseWriter, base time.Duration) {
+	if cfg.RetryAfterJitter > 0 {
+		base += time.Duration(rand.Int63n(int64(cfg.RetryAfterJitter) + 1))
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(base.Seconds())), 1)))
+}
+
+// writeError writes an ErrorResponse with the given status code
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ErrorResponse{
+		Error:     message,
+		Timestamp: nowFunc(),
+	})
+}
+
+// internalErrorResponse builds the body for an unexpected server-side failure.
+// The underlying error is only exposed when ERROR_DETAIL=full.
+func internalErrorResponse(err error) ErrorResponse {
+	response := ErrorResponse{
+		Error:     "Internal server error",
+		Timestamp: nowFunc(),
+	}
+	if strings.ToLower(cfg.ErrorDetail) == "full" {
+		response.Detail = err.Error()
+	}
+	return response
+}
+
+// writeInternalError logs err with request context and writes a 500 response
+func writeInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.Error("Internal error",
+		"error", err,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"request_id", requestIDFromContext(r.Context()),
+	)
+	writeJSON(w, http.StatusInternalServerError, internalErrorResponse(err))
+}
+
+// Made with Bob
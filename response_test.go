@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// failingWriter fails every body write with err
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	err error
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func TestWriteJSONClientDisconnect(t *testing.T) {
+	setConfig(t, nil)
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"broken pipe", syscall.EPIPE, "level=DEBUG msg=\"Client disconnected before response was written\""},
+		{"connection reset", syscall.ECONNRESET, "level=DEBUG msg=\"Client disconnected before response was written\""},
+		{"other error", errors.New("disk on fire"), "level=ERROR msg=\"Failed to write response\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			writeJSON(failingWriter{httptest.NewRecorder(), tt.err}, http.StatusOK, map[string]string{"k": "v"})
+			if got := logs.String(); !strings.Contains(got, tt.want) {
+				t.Errorf("log = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	return body
+}
+
+func TestWriteJSONPlain(t *testing.T) {
+	setConfig(t, func(c *Config) { c.EnvelopeResponses = false })
+
+	rec := httptest.NewRecorder()
+	writeJSON(rec, http.StatusOK, map[string]string{"name": "x"})
+
+	body := decodeBody(t, rec)
+	if body["name"] != "x" {
+		t.Errorf("body = %v, want the value unwrapped", body)
+	}
+	if _, ok := body["data"]; ok {
+		t.Errorf("plain body has an envelope: %v", body)
+	}
+}
+
+func TestWriteJSONEnvelope(t *testing.T) {
+	setConfig(t, func(c *Config) { c.EnvelopeResponses = true })
+
+	rec := httptest.NewRecorder()
+	rec.Header().Set(cfg.RequestIDHeader, "req-1")
+	writeJSON(rec, http.StatusOK, map[string]string{"name": "x"})
+
+	body := decodeBody(t, rec)
+	data, _ := body["data"].(map[string]interface{})
+	if data["name"] != "x" {
+		t.Errorf("data = %v", body["data"])
+	}
+	meta, _ := body["meta"].(map[string]interface{})
+	if meta["request_id"] != "req-1" || meta["timestamp"] == nil {
+		t.Errorf("meta = %v", body["meta"])
+	}
+}
+
+func TestWriteJSONEnvelopeErrors(t *testing.T) {
+	setConfig(t, func(c *Config) { c.EnvelopeResponses = true })
+
+	rec := httptest.NewRecorder()
+	writeError(rec, http.StatusBadRequest, "bad")
+
+	body := decodeBody(t, rec)
+	errBody, _ := body["error"].(map[string]interface{})
+	if errBody["error"] != "bad" {
+		t.Errorf("error = %v", body["error"])
+	}
+	if _, ok := body["data"]; ok {
+		t.Errorf("error response wrapped as data: %v", body)
+	}
+}
+
+func TestErrorDetailModes(t *testing.T) {
+	failing := jsonHandler(func(r *http.Request) (int, interface{}, error) {
+		return 0, nil, errors.New("db password rejected")
+	})
+	client := jsonHandler(func(r *http.Request) (int, interface{}, error) {
+		return 0, nil, apiError(http.StatusBadRequest, "missing_field", "name")
+	})
+
+	for _, mode := range []string{"minimal", "full"} {
+		t.Run(mode, func(t *testing.T) {
+			setConfig(t, func(c *Config) { c.ErrorDetail = mode })
+			logs := captureLogs(t)
+
+			rec := serve(failing, http.MethodGet, "/", "")
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error != "Internal server error" {
+				t.Errorf("error = %q, want the generic message", resp.Error)
+			}
+			leaked := strings.Contains(rec.Body.String(), "db password rejected")
+			if leaked != (mode == "full") {
+				t.Errorf("detail in response = %v: %s", leaked, rec.Body)
+			}
+			if !strings.Contains(logs.String(), "db password rejected") {
+				t.Errorf("detail not logged: %s", logs)
+			}
+
+			if rec := serve(client, http.MethodGet, "/", ""); !strings.Contains(rec.Body.String(), "name") {
+				t.Errorf("4xx error lacks its detail: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestWriteJSONEncodingFailure(t *testing.T) {
+	setConfig(t, nil)
+	logs := captureLogs(t)
+	before := jsonEncodeErrorsTotal.Value("unmatched")
+
+	rec := httptest.NewRecorder()
+	writeJSON(rec, http.StatusOK, struct {
+		Name    string        `json:"name"`
+		Updates chan struct{} `json:"updates"`
+	}{Name: "partial", Updates: make(chan struct{})})
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("body is not a clean error response: %v: %s", err, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "partial") {
+		t.Errorf("body leaks the partially encoded value: %s", rec.Body)
+	}
+	if !strings.Contains(logs.String(), "Failed to encode response") {
+		t.Errorf("encoding failure not logged: %s", logs)
+	}
+	if got := jsonEncodeErrorsTotal.Value("unmatched") - before; got != 1 {
+		t.Errorf("json_encode_errors_total grew by %v, want 1", got)
+	}
+}
+
+func TestPrettyErrorResponses(t *testing.T) {
+	setConfig(t, func(c *Config) { c.PrettyJSON = false })
+	captureLogs(t)
+
+	handlers := map[string]http.HandlerFunc{
+		"api error": jsonHandler(func(r *http.Request) (int, interface{}, error) {
+			return 0, nil, apiError(http.StatusBadRequest, "missing_parameter", "message")
+		}),
+		"writeError": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusForbidden, "Admin endpoints are disabled")
+		},
+		"timeout": timeoutMiddleware(time.Millisecond)(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}),
+	}
+	for name, h := range handlers {
+		rec := serve(prettyMiddleware(h), http.MethodGet, "/?pretty=true", "")
+		if rec.Code < http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want an error", name, rec.Code)
+		}
+		if !strings.HasPrefix(rec.Body.String(), "{\n  \"error\": ") {
+			t.Errorf("%s: error response not pretty-printed: %s", name, rec.Body)
+		}
+
+		plain := serve(prettyMiddleware(h), http.MethodGet, "/", "")
+		if strings.Contains(plain.Body.String(), "\n  ") {
+			t.Errorf("%s: error response indented without ?pretty: %s", name, plain.Body)
+		}
+	}
+}
+
+func TestFieldsFiltering(t *testing.T) {
+	setConfig(t, nil)
+	handler := fieldsMiddleware(jsonHandler(infoHandler))
+
+	rec := serve(handler, http.MethodGet, "/api/info?fields=version,hostname,bogus", "")
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["version"] == nil || got["hostname"] == nil {
+		t.Errorf("fields = %v, want only version and hostname", got)
+	}
+
+	// Errors are never filtered, so clients always see what went wrong
+	failing := fieldsMiddleware(jsonHandler(func(r *http.Request) (int, interface{}, error) {
+		return 0, nil, apiError(http.StatusBadRequest, "missing_parameter", "message")
+	}))
+	rec = serve(failing, http.MethodGet, "/api/echo?fields=version", "")
+	if !strings.Contains(rec.Body.String(), `"error"`) {
+		t.Errorf("error response filtered: %s", rec.Body)
+	}
+}
+
+func TestBodyChecksumHeader(t *testing.T) {
+	setConfig(t, func(c *Config) { c.AddBodyChecksum = true })
+
+	for _, h := range []http.HandlerFunc{jsonHandler(infoHandler), jsonHandler(echoHandler)} {
+		rec := serve(h, http.MethodGet, "/api/echo?message=hi", "")
+		sum := sha256.Sum256(rec.Body.Bytes())
+		if got, want := rec.Header().Get("X-Content-SHA256"), hex.EncodeToString(sum[:]); got != want {
+			t.Errorf("X-Content-SHA256 = %q, want %q for %s", got, want, rec.Body)
+		}
+	}
+
+	setConfig(t, func(c *Config) { c.AddBodyChecksum = false })
+	if got := serve(jsonHandler(infoHandler), http.MethodGet, "/api/info", "").Header().Get("X-Content-SHA256"); got != "" {
+		t.Errorf("checksum %q sent with ADD_BODY_CHECKSUM off", got)
+	}
+}
+
+func TestRetryAfterJitterBounds(t *testing.T) {
+	setConfig(t, func(c *Config) { c.RetryAfterJitter = 5 * time.Second })
+
+	seen := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		rec := httptest.NewRecorder()
+		setRetryAfter(rec, 10*time.Second)
+		got, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+		if err != nil || got < 10 || got > 15 {
+			t.Fatalf("Retry-After = %q, want 10 to 15 seconds", rec.Header().Get("Retry-After"))
+		}
+		seen[got] = true
+	}
+	if len(seen) < 3 {
+		t.Errorf("1000 calls produced only %d distinct values, want the retries spread out", len(seen))
+	}
+}
+
+func TestRetryAfterWithoutJitter(t *testing.T) {
+	setConfig(t, func(c *Config) { c.RetryAfterJitter = 0 })
+	tests := map[time.Duration]string{
+		10 * time.Second:        "10",
+		1500 * time.Millisecond: "2",
+		0:                       "1",
+	}
+	for base, want := range tests {
+		rec := httptest.NewRecorder()
+		setRetryAfter(rec, base)
+		if got := rec.Header().Get("Retry-After"); got != want {
+			t.Errorf("setRetryAfter(%v) = %q, want %q", base, got, want)
+		}
+	}
+}
+
+// Made with Bob
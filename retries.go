@@ -0,0 +1,92 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// retryTracker remembers recently seen request keys so repeated requests
+// can be flagged as likely client retries in the access log. Memory is
+// bounded by both the window and a maximum number of keys.
+type retryTracker struct {
+	mu      sync.Mutex
+	window  time.Duration
+	maxKeys int
+	seen    map[string]*list.Element
+	order   *list.List // of *seenKey, most recently seen first
+}
+
+type seenKey struct {
+	key  string
+	time time.Time
+}
+
+func newRetryTracker(window time.Duration, maxKeys int) *retryTracker {
+	return &retryTracker{
+		window:  window,
+		maxKeys: maxKeys,
+		seen:    make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// retries is configured from RETRY_DETECTION_WINDOW at startup
+var retries *retryTracker
+
+// Seen records key and reports how long ago it was last seen,
+// if that was within the window
+func (t *retryTracker) Seen(key string) (time.Duration, bool) {
+	if t == nil || t.window <= 0 || t.maxKeys <= 0 || key == "" {
+		return 0, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := clock.Now()
+	t.prune(now)
+
+	if elem, ok := t.seen[key]; ok {
+		entry := elem.Value.(*seenKey)
+		last := entry.time
+		entry.time = now
+		t.order.MoveToFront(elem)
+		return now.Sub(last), true
+	}
+
+	if t.order.Len() >= t.maxKeys {
+		oldest := t.order.Back()
+		delete(t.seen, oldest.Value.(*seenKey).key)
+		t.order.Remove(oldest)
+	}
+	t.seen[key] = t.order.PushFront(&seenKey{key: key, time: now})
+	return 0, false
+}
+
+// prune drops keys last seen before the window
+func (t *retryTracker) prune(now time.Time) {
+	for oldest := t.order.Back(); oldest != nil; oldest = t.order.Back() {
+		entry := oldest.Value.(*seenKey)
+		if now.Sub(entry.time) < t.window {
+			return
+		}
+		delete(t.seen, entry.key)
+		t.order.Remove(oldest)
+	}
+}
+
+// retryKey identifies a request for retry detection: the Idempotency-Key
+// header, or a client-supplied request ID
+func retryKey(r *http.Request) string {
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		return "idempotency:" + key
+	}
+	if id := r.Header.Get(cfg.RequestIDHeader); validRequestID(id) {
+		return "request-id:" + id
+	}
+	return ""
+}
+
+// Made with Bob
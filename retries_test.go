@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setRetries replaces the retry tracker for the rest of the test
+func setRetries(t *testing.T, tracker *retryTracker) {
+	t.Helper()
+	saved := retries
+	retries = tracker
+	t.Cleanup(func() { retries = saved })
+}
+
+func TestLoggingAnnotatesRetries(t *testing.T) {
+	setConfig(t, func(c *Config) { c.LogFormat = "text" })
+	logs := captureLogs(t)
+	fake := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	setClock(t, fake)
+	setRetries(t, newRetryTracker(time.Minute, 100))
+	handler := loggingMiddleware(okHandler)
+
+	handler(httptest.NewRecorder(), newRequestWithHeader(http.MethodPost, "/api/data", "Idempotency-Key", "order-1"))
+	if strings.Contains(logs.String(), "retry=likely") {
+		t.Fatalf("first request flagged as a retry: %s", logs)
+	}
+
+	fake.Advance(2 * time.Second)
+	handler(httptest.NewRecorder(), newRequestWithHeader(http.MethodPost, "/api/data", "Idempotency-Key", "order-1"))
+	if !strings.Contains(logs.String(), "retry=likely last_seen=2s") {
+		t.Errorf("repeated request not flagged as a retry: %s", logs)
+	}
+}
+
+func TestRetryTrackerWindowAndBound(t *testing.T) {
+	fake := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	setClock(t, fake)
+
+	tracker := newRetryTracker(10*time.Second, 2)
+	tracker.Seen("a")
+	fake.Advance(11 * time.Second)
+	if _, retry := tracker.Seen("a"); retry {
+		t.Error("key seen outside the window flagged as a retry")
+	}
+
+	tracker.Seen("b")
+	tracker.Seen("c")
+	if len(tracker.seen) > 2 {
+		t.Errorf("tracker holds %d keys, want at most 2", len(tracker.seen))
+	}
+	if _, retry := tracker.Seen("c"); !retry {
+		t.Error("recent key forgotten")
+	}
+}
+
+func TestRetryTrackerRepeatedKeyStaysBounded(t *testing.T) {
+	fake := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	setClock(t, fake)
+
+	tracker := newRetryTracker(time.Minute, 2)
+	tracker.Seen("other")
+	for i := 0; i < 100; i++ {
+		fake.Advance(100 * time.Millisecond)
+		tracker.Seen("hot")
+	}
+	if got := tracker.order.Len(); got > tracker.maxKeys {
+		t.Errorf("tracker holds %d entries after repeated sightings, want at most %d", got, tracker.maxKeys)
+	}
+	if len(tracker.seen) != tracker.order.Len() {
+		t.Errorf("%d keys but %d entries, want one entry per key", len(tracker.seen), tracker.order.Len())
+	}
+
+	// Repeat sightings keep a key fresh, so it outlives older keys
+	tracker.Seen("new")
+	if _, retry := tracker.Seen("hot"); !retry {
+		t.Error("hot key evicted before an older one")
+	}
+	if _, ok := tracker.seen["other"]; ok {
+		t.Error("least recently seen key kept over the bound")
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,26 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package main
+
+import (
+	"syscall"
+)
+
+const reusePortSupported = true
+
+// SO_REUSEPORT is not exported by the syscall package on every architecture
+const soReusePort = 0xf
+
+// reusePortControl sets SO_REUSEPORT so several processes can bind the same port
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// Made with Bob
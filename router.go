@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type contextKey string
+
+const (
+	pathParamsKey   contextKey = "pathParams"
+	routePatternKey contextKey = "routePattern"
+	routePrefixKey  contextKey = "routePrefix"
+)
+
+// route is a single method/pattern registration. canonical is the pattern
+// without any group prefix, shared by every API version of the route.
+type route struct {
+	method    string
+	pattern   string
+	canonical string
+	segments  []string
+	handler   http.HandlerFunc
+	timeout   time.Duration
+	rateLimit RateLimit
+	slots     concurrencyLimit
+}
+
+// RouteOption customizes a single route at registration
+type RouteOption func(*route)
+
+// WithTimeout overrides the router's default handler timeout for one route
+func WithTimeout(d time.Duration) RouteOption {
+	return func(rte *route) { rte.timeout = d }
+}
+
+// WithRateLimit overrides the router's default rate limit for one route;
+// a zero limit keeps the default
+func WithRateLimit(limit RateLimit) RouteOption {
+	return func(rte *route) { rte.rateLimit = limit }
+}
+
+// WithConcurrencyLimit caps how many requests the route, together with the
+// other routes given the same limit, handles at once
+func WithConcurrencyLimit(slots concurrencyLimit) RouteOption {
+	return func(rte *route) { rte.slots = slots }
+}
+
+// Router dispatches requests by method and path pattern.
+// Patterns may contain {name} segments which are exposed via pathParam.
+// Timeout, when positive, bounds every handler unless its route overrides it
+// with WithTimeout or an entry in RouteTimeouts, keyed by "METHOD pattern"
+// without group prefixes.
+// RateLimit likewise applies per client IP and route unless overridden;
+// probe paths are never limited. MaxRoutes, when positive, caps how many
+// routes may be registered.
+type Router struct {
+	routes        []*route
+	NotFound      http.HandlerFunc
+	Timeout       time.Duration
+	RouteTimeouts map[string]time.Duration
+	RateLimit     RateLimit
+	MaxRoutes     int
+}
+
+func NewRouter() *Router {
+	return &Router{NotFound: notFoundHandler}
+}
+
+// Handle registers handler for the given method and pattern. Like
+// http.ServeMux it panics if the method and pattern are already registered,
+// including patterns differing only in parameter names, or if it would
+// exceed MaxRoutes, catching registration loops gone wrong at startup.
+func (rt *Router) Handle(method, pattern string, handler http.HandlerFunc, opts ...RouteOption) {
+	rt.handle(method, pattern, pattern, handler, opts)
+}
+
+func (rt *Router) handle(method, pattern, canonical string, handler http.HandlerFunc, opts []RouteOption) {
+	rte := &route{
+		method:    method,
+		pattern:   pattern,
+		canonical: canonical,
+		segments:  splitPath(pattern),
+		handler:   handler,
+	}
+	for _, existing := range rt.routes {
+		if existing.method == method && existing.conflicts(rte) {
+			panic(fmt.Sprintf("router: duplicate route %s %s conflicts with %s %s",
+				method, pattern, existing.method, existing.pattern))
+		}
+	}
+	if rt.MaxRoutes > 0 && len(rt.routes) >= rt.MaxRoutes {
+		panic(fmt.Sprintf("router: registering %s %s exceeds the maximum of %d routes",
+			method, pattern, rt.MaxRoutes))
+	}
+	for _, opt := range opts {
+		opt(rte)
+	}
+	if d, ok := rt.RouteTimeouts[method+" "+canonical]; ok {
+		WithTimeout(d)(rte)
+	}
+	rt.routes = append(rt.routes, rte)
+}
+
+// RouteRegistrar is implemented by Router and RouteGroup, so the same set
+// of routes can be registered at the root or under a prefix
+type RouteRegistrar interface {
+	Handle(method, pattern string, handler http.HandlerFunc, opts ...RouteOption)
+}
+
+// RouteGroup registers routes under a shared path prefix, such as an API version
+type RouteGroup struct {
+	router *Router
+	prefix string
+}
+
+// Group registers the routes added by register under prefix as one unit
+func (rt *Router) Group(prefix string, register func(g *RouteGroup)) {
+	register(&RouteGroup{router: rt, prefix: "/" + strings.Trim(prefix, "/")})
+}
+
+// Handle registers handler for method and prefix+pattern
+func (g *RouteGroup) Handle(method, pattern string, handler http.HandlerFunc, opts ...RouteOption) {
+	g.router.handle(method, g.prefix+pattern, pattern, handler, opts)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// CONNECT asks the server to open a tunnel, which only a handler
+	// registered for it could do; otherwise it is refused for any target.
+	// The target is a host:port rather than a path, so Allow lists every
+	// method the router serves.
+	if r.Method == http.MethodConnect && !rt.handlesMethod(http.MethodConnect) {
+		w.Header().Set("Allow", strings.Join(rt.servedMethods(), ", "))
+		writeLocalizedError(w, r, http.StatusMethodNotAllowed, "connect_not_supported")
+		return
+	}
+
+	segments := splitPath(r.URL.Path)
+
+	var best *route
+	var bestParams map[string]string
+	bestScore := -1
+	allowed := map[string]bool{}
+
+	for _, rte := range rt.routes {
+		params, score, ok := rte.match(segments)
+		if !ok {
+			continue
+		}
+		allowed[rte.method] = true
+		if rte.method == http.MethodGet {
+			allowed[http.MethodHead] = true
+		}
+		if !methodMatches(rte.method, r.Method) {
+			continue
+		}
+		// An explicit HEAD route beats the implicit GET fallback
+		if score > bestScore || (score == bestScore && rte.method == r.Method) {
+			best, bestParams, bestScore = rte, params, score
+		}
+	}
+
+	if best == nil {
+		if len(allowed) > 0 {
+			methodNotAllowed(w, r, allowed)
+			return
+		}
+		rt.NotFound(w, r)
+		return
+	}
+
+	if pattern, ok := r.Context().Value(routePatternKey).(*string); ok {
+		*pattern = best.pattern
+	}
+
+	limit := rt.RateLimit
+	if best.rateLimit.RPS > 0 {
+		limit = best.rateLimit
+	}
+	if limit.RPS > 0 && !probePaths[r.URL.Path] {
+		decision := routeRateLimiter.Allow(rateLimitKey(r, best), limit)
+		if cfg.RateLimitHeaders {
+			setRateLimitHeaders(w, decision)
+		}
+		if !decision.Allowed {
+			rateLimited(w, r, decision.RetryAfter)
+			return
+		}
+	}
+
+	if len(bestParams) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), pathParamsKey, bestParams))
+	}
+	if prefix := strings.TrimSuffix(best.pattern, best.canonical); prefix != "" {
+		r = r.WithContext(context.WithValue(r.Context(), routePrefixKey, prefix))
+	}
+	if r.Method == http.MethodHead && best.method == http.MethodGet {
+		w = headResponseWriter{w}
+	}
+
+	// Drained inside the timeout, on the handler's goroutine, which also
+	// holds any concurrency slot until the handler really returns
+	handler := drainBody(best.slots.middleware(best.handler))
+	timeout := rt.Timeout
+	if best.timeout > 0 {
+		timeout = best.timeout
+	}
+	if timeout > 0 {
+		handler = timeoutMiddleware(timeout)(handler)
+	}
+	handler(w, r)
+}
+
+// handlesMethod reports whether any route is registered for method
+func (rt *Router) handlesMethod(method string) bool {
+	for _, rte := range rt.routes {
+		if rte.method == method {
+			return true
+		}
+	}
+	return false
+}
+
+// servedMethods lists every method some route is registered for, including
+// the implicit HEAD for GET routes, sorted
+func (rt *Router) servedMethods() []string {
+	served := map[string]bool{}
+	for _, rte := range rt.routes {
+		served[rte.method] = true
+		if rte.method == http.MethodGet {
+			served[http.MethodHead] = true
+		}
+	}
+	return sortedMethods(served)
+}
+
+// AllowedMethods lists the methods registered for path, including the
+// implicit HEAD for GET routes, sorted. It is empty if no route matches.
+func (rt *Router) AllowedMethods(path string) []string {
+	segments := splitPath(path)
+	allowed := map[string]bool{}
+	for _, rte := range rt.routes {
+		if _, _, ok := rte.match(segments); !ok {
+			continue
+		}
+		allowed[rte.method] = true
+		if rte.method == http.MethodGet {
+			allowed[http.MethodHead] = true
+		}
+	}
+	return sortedMethods(allowed)
+}
+
+// methodMatches reports whether a route registered for routeMethod serves
+// requestMethod; GET routes also answer HEAD
+func methodMatches(routeMethod, requestMethod string) bool {
+	return routeMethod == requestMethod ||
+		(routeMethod == http.MethodGet && requestMethod == http.MethodHead)
+}
+
+// headResponseWriter runs a GET handler for a HEAD request, keeping its
+// headers and status but discarding the body
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// match reports whether the path segments fit the route, returning the
+// captured parameters and the number of literal segments matched
+func (rte *route) match(segments []string) (map[string]string, int, bool) {
+	if len(segments) != len(rte.segments) {
+		return nil, 0, false
+	}
+
+	var params map[string]string
+	score := 0
+	for i, seg := range rte.segments {
+		if isParam(seg) {
+			if segments[i] == "" {
+				return nil, 0, false
+			}
+			if params == nil {
+				params = map[string]string{}
+			}
+			params[seg[1:len(seg)-1]] = segments[i]
+			continue
+		}
+		if seg != segments[i] {
+			return nil, 0, false
+		}
+		score++
+	}
+	return params, score, true
+}
+
+// conflicts reports whether two routes match exactly the same paths
+func (rte *route) conflicts(other *route) bool {
+	if len(rte.segments) != len(other.segments) {
+		return false
+	}
+	for i, seg := range rte.segments {
+		if isParam(seg) != isParam(other.segments[i]) {
+			return false
+		}
+		if !isParam(seg) && seg != other.segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isParam(seg string) bool {
+	return strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// pathParam returns the value captured for a {name} segment
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(pathParamsKey).(map[string]string)
+	return params[name]
+}
+
+// routePrefix returns the group prefix, such as "/v1", of the route serving
+// r, or "" for a route registered at the root
+func routePrefix(r *http.Request) string {
+	prefix, _ := r.Context().Value(routePrefixKey).(string)
+	return prefix
+}
+
+// captureRoute lets middleware outside the router learn which route
+// pattern served the request once the handler returns
+func captureRoute(r *http.Request) (*http.Request, *string) {
+	if pattern, ok := r.Context().Value(routePatternKey).(*string); ok {
+		return r, pattern
+	}
+	pattern := new(string)
+	return r.WithContext(context.WithValue(r.Context(), routePatternKey, pattern)), pattern
+}
+
+func sortedMethods(allowed map[string]bool) []string {
+	methods := make([]string, 0, len(allowed))
+	for m := range allowed {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed map[string]bool) {
+	list := strings.Join(sortedMethods(allowed), ", ")
+	w.Header().Set("Allow", list)
+	writeLocalizedError(w, r, http.StatusMethodNotAllowed, "method_not_allowed", list)
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeLocalizedError(w, r, http.StatusNotFound, "not_found")
+}
+
+// Made with Bob
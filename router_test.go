@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeadHealth(t *testing.T) {
+	setConfig(t, nil)
+	// A stopped clock keeps the uptime, and so the body length, constant
+	setClock(t, newFakeClock(time.Now()))
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/health", healthHandler)
+
+	head := serve(router, http.MethodHead, "/health", "")
+	if head.Code != http.StatusOK {
+		t.Errorf("HEAD status = %d, want %d", head.Code, http.StatusOK)
+	}
+	if head.Body.Len() != 0 {
+		t.Errorf("HEAD body = %q, want none", head.Body)
+	}
+	if got := head.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("HEAD Content-Type = %q", got)
+	}
+
+	get := serve(router, http.MethodGet, "/health", "")
+	if got, want := head.Header().Get("Content-Length"), get.Header().Get("Content-Length"); got == "" || got != want {
+		t.Errorf("HEAD Content-Length = %q, GET has %q", got, want)
+	}
+}
+
+func TestHeadNotAllowedWithoutGet(t *testing.T) {
+	setConfig(t, nil)
+	router := NewRouter()
+	router.Handle(http.MethodPost, "/submit", okHandler)
+
+	if rec := serve(router, http.MethodHead, "/submit", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("HEAD on a POST-only route: status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+// sleepHandler answers 200 after d unless the request is cancelled first
+func sleepHandler(d time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(d):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	}
+}
+
+func TestPerRouteTimeouts(t *testing.T) {
+	setConfig(t, nil)
+	captureLogs(t)
+	router := NewRouter()
+	router.Timeout = 20 * time.Millisecond
+	router.RouteTimeouts = map[string]time.Duration{"POST /api/upload": 2 * time.Second}
+
+	router.Handle(http.MethodGet, "/api/echo", sleepHandler(200*time.Millisecond))
+	router.Handle(http.MethodGet, "/api/report", sleepHandler(200*time.Millisecond), WithTimeout(2*time.Second))
+	router.Group("/v1", func(g *RouteGroup) {
+		g.Handle(http.MethodPost, "/api/upload", sleepHandler(200*time.Millisecond))
+	})
+
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/api/echo", cfg.TimeoutStatus},
+		{http.MethodGet, "/api/report", http.StatusOK},
+		{http.MethodPost, "/v1/api/upload", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := serve(router, tt.method, tt.target, ""); rec.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.target, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestParseRouteTimeouts(t *testing.T) {
+	logs := captureLogs(t)
+	got := parseRouteTimeouts([]string{"post /api/echo/raw=30s", "GET /slow = 1m", "GET /bad=soon", "nopattern=5s", "GET /zero=0s"})
+
+	want := map[string]time.Duration{"POST /api/echo/raw": 30 * time.Second, "GET /slow": time.Minute}
+	if len(got) != len(want) || got["POST /api/echo/raw"] != want["POST /api/echo/raw"] || got["GET /slow"] != want["GET /slow"] {
+		t.Errorf("timeouts = %v, want %v", got, want)
+	}
+	for _, entry := range []string{"GET /bad=soon", "nopattern=5s", "GET /zero=0s"} {
+		if !strings.Contains(logs.String(), entry) {
+			t.Errorf("no warning for %q", entry)
+		}
+	}
+}
+
+// registerPanic returns the panic message from register, or "" if it did not panic
+func registerPanic(register func()) (msg string) {
+	defer func() {
+		if p := recover(); p != nil {
+			msg = fmt.Sprint(p)
+		}
+	}()
+	register()
+	return ""
+}
+
+func TestDuplicateRouteRegistration(t *testing.T) {
+	tests := []struct {
+		name     string
+		first    string
+		second   string
+		conflict bool
+	}{
+		{"same pattern", "/api/data/{name}", "/api/data/{name}", true},
+		{"renamed parameter", "/api/data/{name}", "/api/data/{id}", true},
+		{"literal and parameter", "/api/data/{name}", "/api/data/jobs", false},
+		{"different path", "/api/info", "/api/echo", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewRouter()
+			router.Handle(http.MethodGet, tt.first, okHandler)
+			msg := registerPanic(func() { router.Handle(http.MethodGet, tt.second, okHandler) })
+
+			if !tt.conflict {
+				if msg != "" {
+					t.Errorf("unexpected panic: %s", msg)
+				}
+				return
+			}
+			if !strings.Contains(msg, "GET "+tt.second) || !strings.Contains(msg, "GET "+tt.first) {
+				t.Errorf("panic %q does not name both routes", msg)
+			}
+		})
+	}
+
+	// The same pattern under another method is a separate route
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/api/info", okHandler)
+	if msg := registerPanic(func() { router.Handle(http.MethodPost, "/api/info", okHandler) }); msg != "" {
+		t.Errorf("POST after GET panicked: %s", msg)
+	}
+}
+
+func TestMaxRoutes(t *testing.T) {
+	router := NewRouter()
+	router.MaxRoutes = 1
+	router.Handle(http.MethodGet, "/one", okHandler)
+	if msg := registerPanic(func() { router.Handle(http.MethodGet, "/two", okHandler) }); !strings.Contains(msg, "maximum of 1 routes") {
+		t.Errorf("panic = %q, want the route limit", msg)
+	}
+}
+
+func TestMaxRoutesStopsRunawayRegistration(t *testing.T) {
+	setConfig(t, nil)
+	router := NewRouter()
+	router.MaxRoutes = 50
+
+	registered := 0
+	msg := registerPanic(func() {
+		for i := 0; i < 1000; i++ {
+			router.Group(fmt.Sprintf("/gen%d", i), func(g *RouteGroup) {
+				g.Handle(http.MethodGet, "/item", okHandler)
+			})
+			registered++
+		}
+	})
+	if registered != 50 || !strings.Contains(msg, "GET /gen50/item exceeds the maximum of 50 routes") {
+		t.Errorf("registered %d routes, panic %q; want the 51st refused", registered, msg)
+	}
+}
+
+func TestMaxRoutesFitsTheAPI(t *testing.T) {
+	setConfig(t, nil)
+	count := len(newAPIRouter(t).routes)
+
+	router := NewRouter()
+	router.MaxRoutes = count
+	if msg := registerPanic(func() { registerAPIv1(router) }); msg != "" {
+		t.Errorf("MAX_ROUTES equal to the API's %d routes: panic %q", count, msg)
+	}
+	router = NewRouter()
+	router.MaxRoutes = count - 1
+	if msg := registerPanic(func() { registerAPIv1(router) }); msg == "" {
+		t.Errorf("MAX_ROUTES of %d accepted the API's %d routes", count-1, count)
+	}
+}
+
+func TestConnectRejected(t *testing.T) {
+	setConfig(t, nil)
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/", okHandler)
+	router.Handle(http.MethodGet, "/api/info", okHandler)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	addr := ts.Listener.Addr().String()
+
+	for _, raw := range []string{
+		"CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n",
+		"CONNECT /api/info HTTP/1.1\r\nHost: test\r\n\r\n",
+	} {
+		status, body := rawRequest(t, addr, raw)
+		if status != http.StatusMethodNotAllowed {
+			t.Errorf("%q: status = %d, want %d", raw, status, http.StatusMethodNotAllowed)
+		}
+		if !strings.Contains(body, `"code":"connect_not_supported"`) {
+			t.Errorf("%q: body = %s, want connect_not_supported", raw, body)
+		}
+	}
+}
+
+func TestConnectAllowListsServedMethods(t *testing.T) {
+	setConfig(t, nil)
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/", okHandler)
+	router.Handle(http.MethodPost, "/api/data", okHandler)
+	router.Handle(http.MethodDelete, "/api/data/{name}", okHandler)
+
+	for _, target := range []string{"example.com:443", "/api/data"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodConnect, target, nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("CONNECT %s: status = %d, want %d", target, rec.Code, http.StatusMethodNotAllowed)
+		}
+		if got := rec.Header().Get("Allow"); got != "DELETE, GET, HEAD, POST" {
+			t.Errorf("CONNECT %s: Allow = %q, want every method the router serves", target, got)
+		}
+	}
+}
+
+func TestConnectServedWhenRegistered(t *testing.T) {
+	setConfig(t, nil)
+	router := NewRouter()
+	router.Handle(http.MethodConnect, "/tunnel", okHandler)
+
+	if rec := serve(router, http.MethodConnect, "/tunnel", ""); rec.Code != http.StatusOK {
+		t.Errorf("registered CONNECT: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var (
+	// shuttingDown flips /health to unhealthy once shutdown begins
+	shuttingDown atomic.Bool
+
+	// backgroundWorkers tracks goroutines that must finish before exit
+	backgroundWorkers sync.WaitGroup
+
+	// inFlightRequests counts requests currently being served,
+	// requestsServed those completed since startup
+	inFlightRequests atomic.Int64
+	requestsServed   atomic.Int64
+
+	// draining is set while server.Shutdown runs; drainServed counts the
+	// requests that finished during that window
+	draining    atomic.Bool
+	drainServed atomic.Int64
+
+	// servingListener is the listener IDLE_DRAIN closes before waiting
+	servingListener atomic.Pointer[drainListener]
+)
+
+// openConns tracks the state of client connections while IDLE_DRAIN is set
+var openConns = &connStates{conns: make(map[net.Conn]http.ConnState)}
+
+type connStates struct {
+	mu    sync.Mutex
+	conns map[net.Conn]http.ConnState
+}
+
+// ConnState is a ConnState hook maintaining the tracked connections
+func (c *connStates) ConnState(conn net.Conn, state http.ConnState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		delete(c.conns, conn)
+	default:
+		c.conns[conn] = state
+	}
+}
+
+// Counts returns how many connections are handling a request, or about
+// to, and how many are idle between keep-alive requests
+func (c *connStates) Counts() (active, idle int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, state := range c.conns {
+		if state == http.StateIdle {
+			idle++
+		} else {
+			active++
+		}
+	}
+	return active, idle
+}
+
+// drainListener lets IDLE_DRAIN stop accepting connections before
+// server.Shutdown, which closes the listener again
+type drainListener struct {
+	net.Listener
+	once   sync.Once
+	closed atomic.Bool
+	err    error
+}
+
+// newDrainListener wraps ln as the listener IDLE_DRAIN closes
+func newDrainListener(ln net.Listener) net.Listener {
+	dl := &drainListener{Listener: ln}
+	servingListener.Store(dl)
+	return dl
+}
+
+func (l *drainListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil && l.closed.Load() {
+		// Lets Serve return as it does after server.Shutdown
+		return nil, http.ErrServerClosed
+	}
+	return conn, err
+}
+
+func (l *drainListener) Close() error {
+	l.once.Do(func() {
+		l.closed.Store(true)
+		l.err = l.Listener.Close()
+	})
+	return l.err
+}
+
+// combineConnState chains ConnState hooks, returning nil when there are none
+func combineConnState(hooks []func(net.Conn, http.ConnState)) func(net.Conn, http.ConnState) {
+	if len(hooks) == 0 {
+		return nil
+	}
+	return func(conn net.Conn, state http.ConnState) {
+		for _, hook := range hooks {
+			hook(conn, state)
+		}
+	}
+}
+
+// inFlightMiddleware maintains inFlightRequests and counts requests
+// completed while the server is draining
+func inFlightMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inFlightRequests.Add(1)
+		defer func() {
+			inFlightRequests.Add(-1)
+			requestsServed.Add(1)
+			if draining.Load() {
+				drainServed.Add(1)
+			}
+		}()
+		next(w, r)
+	}
+}
+
+// shutdownSignalNames lists the signals SHUTDOWN_SIGNALS may name
+var shutdownSignalNames = map[string]os.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGQUIT": syscall.SIGQUIT,
+}
+
+// parseShutdownSignals resolves names such as "SIGTERM" or "term"
+func parseShutdownSignals(names []string) ([]os.Signal, error) {
+	signals := make([]os.Signal, 0, len(names))
+	for _, name := range names {
+		key := strings.ToUpper(name)
+		if !strings.HasPrefix(key, "SIG") {
+			key = "SIG" + key
+		}
+		sig, ok := shutdownSignalNames[key]
+		if !ok {
+			return nil, fmt.Errorf("unsupported shutdown signal %q: use SIGINT, SIGTERM or SIGQUIT", name)
+		}
+		signals = append(signals, sig)
+	}
+	return signals, nil
+}
+
+// waitForShutdownSignal blocks until a shutdown signal arrives and returns it.
+// SIGQUIT first dumps all goroutine stacks to stderr, as Go does by default.
+func waitForShutdownSignal(signals <-chan os.Signal) os.Signal {
+	sig := <-signals
+	if sig == syscall.SIGQUIT {
+		log.Println("SIGQUIT received, dumping goroutine stacks")
+		pprof.Lookup("goroutine").WriteTo(os.Stderr, 2)
+	}
+	return sig
+}
+
+// shutdownConfigFor adjusts c for the signal that stopped the server. With
+// SIGINT_SHUTDOWN_TIMEOUT set, SIGINT (Ctrl-C in local development) skips
+// the pre-shutdown delay and idle drain and uses that shorter timeout;
+// other signals get the full graceful drain.
+func shutdownConfigFor(sig os.Signal, c Config) Config {
+	if sig != syscall.SIGINT || c.SIGINTShutdownTimeout <= 0 {
+		return c
+	}
+	log.Printf("SIGINT received, shutting down quickly (timeout %v)", c.SIGINTShutdownTimeout)
+	c.PreShutdownDelay = 0
+	c.IdleDrain = 0
+	c.ShutdownTimeout = c.SIGINTShutdownTimeout
+	return c
+}
+
+// gracefulShutdown runs the shutdown phases in order:
+// mark unhealthy, wait for load balancers, drain requests, wait for workers
+func gracefulShutdown(server *http.Server, c Config) error {
+	markUnhealthy()
+	preShutdownDelay(c.PreShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+	defer cancel()
+
+	if err := drainServer(ctx, server, c.IdleDrain); err != nil {
+		return err
+	}
+	return waitForWorkers(ctx)
+}
+
+// Phase 1: report unhealthy so load balancers stop routing new traffic
+func markUnhealthy() {
+	shuttingDown.Store(true)
+	log.Println("Shutdown phase 1: health check now reports unhealthy")
+}
+
+// Phase 2: give load balancers time to deregister this instance
+func preShutdownDelay(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	log.Printf("Shutdown phase 2: waiting %v for load balancers to deregister", d)
+	time.Sleep(d)
+}
+
+// Phase 3: stop accepting connections and drain in-flight requests,
+// then log how long draining took and how many requests it let finish.
+// With IDLE_DRAIN, requests in progress first get up to idleDrain to finish
+// with Connection: close, so their clients do not reuse a connection that
+// server.Shutdown is about to close.
+func drainServer(ctx context.Context, server *http.Server, idleDrain time.Duration) error {
+	inFlight := inFlightRequests.Load()
+	log.Printf("Shutdown phase 3: draining %d in-flight requests", inFlight)
+
+	start := clock.Now()
+	draining.Store(true)
+	if idleDrain > 0 {
+		waitForConnsToClose(ctx, server, idleDrain)
+	}
+	err := server.Shutdown(ctx)
+	draining.Store(false)
+
+	logLifecycle("server.drained",
+		"drain_duration", clock.Since(start).String(),
+		"in_flight_at_drain", inFlight,
+		"requests_during_drain", drainServed.Load(),
+		"still_in_flight", inFlightRequests.Load(),
+	)
+	return err
+}
+
+// waitForConnsToClose stops accepting connections, closes idle ones and
+// waits up to d for the others to finish their request and close. Idle
+// connections would only close on a further request, which may never come.
+func waitForConnsToClose(ctx context.Context, server *http.Server, d time.Duration) {
+	if ln := servingListener.Load(); ln != nil {
+		if err := ln.Close(); err != nil {
+			log.Printf("Warning: failed to stop accepting connections: %v", err)
+		}
+	}
+	active, idle := openConns.Counts()
+	// Also sends Connection: close on every response still to come
+	server.SetKeepAlivesEnabled(false)
+	log.Printf("Closed %d idle connections, waiting up to %v for %d active ones to finish", idle, d, active)
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for active > 0 {
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			log.Printf("Closing connections after %v with %d still active", d, active)
+			return
+		case <-ctx.Done():
+			return
+		}
+		active, _ = openConns.Counts()
+	}
+}
+
+// Phase 4: wait for background workers and flush pending spans
+func waitForWorkers(ctx context.Context) error {
+	log.Println("Shutdown phase 4: waiting for background workers")
+
+	if dataJobs != nil {
+		dataJobs.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		backgroundWorkers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if spanExporter != nil {
+		return spanExporter.Shutdown(ctx)
+	}
+	return nil
+}
+
+// Made with Bob
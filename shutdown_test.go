@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func resetShutdownState(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		shuttingDown.Store(false)
+		draining.Store(false)
+	})
+}
+
+func TestGracefulShutdownPhasesInOrder(t *testing.T) {
+	setConfig(t, nil)
+	resetShutdownState(t)
+	logs := captureLogs(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ts := httptest.NewServer(inFlightMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-started
+
+	c := cfg
+	c.PreShutdownDelay = 20 * time.Millisecond
+	c.ShutdownTimeout = 5 * time.Second
+	done := make(chan error, 1)
+	go func() { done <- gracefulShutdown(ts.Config, c) }()
+
+	time.Sleep(50 * time.Millisecond)
+	if !shuttingDown.Load() {
+		t.Error("health was not marked unhealthy")
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("shutdown finished with a request in flight: %v", err)
+	default:
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("gracefulShutdown: %v", err)
+	}
+	if got := <-status; got != http.StatusOK {
+		t.Errorf("in-flight request status = %d, want %d", got, http.StatusOK)
+	}
+
+	out := logs.String()
+	last := -1
+	for _, phase := range []string{"phase 1", "phase 2", "phase 3", "server.drained", "phase 4"} {
+		i := strings.Index(out, phase)
+		if i < 0 {
+			t.Fatalf("%q not logged:\n%s", phase, out)
+		}
+		if i < last {
+			t.Errorf("%q logged out of order:\n%s", phase, out)
+		}
+		last = i
+	}
+}
+
+func TestPreShutdownDelaySkippedWhenZero(t *testing.T) {
+	logs := captureLogs(t)
+	preShutdownDelay(0)
+	if strings.Contains(logs.String(), "phase 2") {
+		t.Error("phase 2 ran without PRE_SHUTDOWN_DELAY")
+	}
+}
+
+func TestParseShutdownSignals(t *testing.T) {
+	got, err := parseShutdownSignals([]string{"SIGTERM", "int", "Quit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []os.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("signals = %v, want %v", got, want)
+	}
+
+	if _, err := parseShutdownSignals([]string{"SIGKILL"}); err == nil {
+		t.Error("SIGKILL accepted")
+	}
+}
+
+func TestShutdownSignalTriggersShutdown(t *testing.T) {
+	signals, err := parseShutdownSignals([]string{"SIGTERM"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, signals...)
+	defer signal.Stop(quit)
+
+	got := make(chan os.Signal, 1)
+	go func() { got <- waitForShutdownSignal(quit) }()
+
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := self.Signal(syscall.SIGTERM); err != nil {
+		t.Skipf("cannot signal own process: %v", err)
+	}
+	select {
+	case sig := <-got:
+		if sig != syscall.SIGTERM {
+			t.Errorf("shutdown triggered by %v, want SIGTERM", sig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGTERM did not trigger shutdown")
+	}
+}
+
+func TestShutdownConfigForSIGINT(t *testing.T) {
+	captureLogs(t)
+	c := Config{PreShutdownDelay: 5 * time.Second, IdleDrain: time.Second, ShutdownTimeout: 30 * time.Second, SIGINTShutdownTimeout: 2 * time.Second}
+
+	if got := shutdownConfigFor(syscall.SIGTERM, c); got.ShutdownTimeout != 30*time.Second || got.PreShutdownDelay != 5*time.Second {
+		t.Errorf("SIGTERM: timeout %v, delay %v; want the full drain", got.ShutdownTimeout, got.PreShutdownDelay)
+	}
+	got := shutdownConfigFor(syscall.SIGINT, c)
+	if got.ShutdownTimeout != 2*time.Second || got.PreShutdownDelay != 0 || got.IdleDrain != 0 {
+		t.Errorf("SIGINT: timeout %v, delay %v, idle drain %v; want a quick shutdown", got.ShutdownTimeout, got.PreShutdownDelay, got.IdleDrain)
+	}
+}
+
+func TestShutdownSignalPathsTimeouts(t *testing.T) {
+	setConfig(t, nil)
+	captureLogs(t)
+	c := Config{ShutdownTimeout: 5 * time.Second, SIGINTShutdownTimeout: 100 * time.Millisecond}
+
+	tests := []struct {
+		sig      os.Signal
+		wantDone bool
+	}{
+		{syscall.SIGINT, false},
+		{syscall.SIGTERM, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sig.String(), func(t *testing.T) {
+			resetShutdownState(t)
+			started := make(chan struct{})
+			ts := httptest.NewServer(inFlightMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				time.Sleep(500 * time.Millisecond)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer ts.Close()
+
+			go func() {
+				if resp, err := http.Get(ts.URL); err == nil {
+					resp.Body.Close()
+				}
+			}()
+			<-started
+
+			start := time.Now()
+			err := gracefulShutdown(ts.Config, shutdownConfigFor(tt.sig, c))
+			elapsed := time.Since(start)
+			if tt.wantDone {
+				if err != nil || elapsed < 400*time.Millisecond {
+					t.Errorf("shutdown = %v after %v, want the request drained", err, elapsed)
+				}
+				return
+			}
+			if !errors.Is(err, context.DeadlineExceeded) || elapsed > 400*time.Millisecond {
+				t.Errorf("shutdown = %v after %v, want the 100ms SIGINT timeout", err, elapsed)
+			}
+		})
+	}
+}
+
+func TestDrainSummaryLogged(t *testing.T) {
+	setConfig(t, nil)
+	resetShutdownState(t)
+	buf := &logBuffer{}
+	setLogger(t, slog.New(slog.NewJSONHandler(buf, nil)))
+	drainServed.Store(0)
+
+	started := make(chan struct{})
+	ts := httptest.NewServer(inFlightMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	go func() {
+		if resp, err := http.Get(ts.URL); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := drainServer(ctx, ts.Config, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var summary struct {
+		Msg                 string  `json:"msg"`
+		DrainDuration       string  `json:"drain_duration"`
+		InFlightAtDrain     float64 `json:"in_flight_at_drain"`
+		RequestsDuringDrain float64 `json:"requests_during_drain"`
+		StillInFlight       float64 `json:"still_in_flight"`
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.Contains(line, `"server.drained"`) {
+			if err := json.Unmarshal([]byte(line), &summary); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if summary.Msg == "" {
+		t.Fatalf("no drain summary logged:\n%s", buf)
+	}
+
+	d, err := time.ParseDuration(summary.DrainDuration)
+	if err != nil || d <= 0 || d > 5*time.Second {
+		t.Errorf("drain_duration = %q, want a positive duration within the timeout", summary.DrainDuration)
+	}
+	if summary.InFlightAtDrain != 1 || summary.RequestsDuringDrain != 1 || summary.StillInFlight != 0 {
+		t.Errorf("summary = %+v, want 1 in flight, 1 served during the drain, none left", summary)
+	}
+}
+
+// drainTestServer starts a server whose listener and connections are
+// tracked for IDLE_DRAIN
+func drainTestServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	saved := openConns
+	openConns = &connStates{conns: make(map[net.Conn]http.ConnState)}
+	t.Cleanup(func() {
+		openConns = saved
+		servingListener.Store(nil)
+	})
+
+	ts := httptest.NewUnstartedServer(handler)
+	ts.Listener = newDrainListener(ts.Listener)
+	ts.Config.ConnState = openConns.ConnState
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// idleConnServer starts a drain test server and leaves one idle keep-alive
+// connection to it from the returned client
+func idleConnServer(t *testing.T) (*httptest.Server, *http.Client) {
+	t.Helper()
+	ts := drainTestServer(t, okHandler)
+
+	client := &http.Client{Transport: &http.Transport{}}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if active, idle := openConns.Counts(); active != 0 || idle != 1 {
+		t.Fatalf("connections: %d active, %d idle; want 1 idle", active, idle)
+	}
+	return ts, client
+}
+
+func TestIdleDrainDoesNotWaitForIdleConnections(t *testing.T) {
+	setConfig(t, nil)
+	resetShutdownState(t)
+	captureLogs(t)
+	ts, _ := idleConnServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := drainServer(ctx, ts.Config, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("drain took %v, want idle connections not to hold it up", elapsed)
+	}
+}
+
+func TestIdleDrainWaitsForActiveRequests(t *testing.T) {
+	setConfig(t, nil)
+	resetShutdownState(t)
+	captureLogs(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ts := drainTestServer(t, inFlightMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Error(err)
+			close(responses)
+			return
+		}
+		resp.Body.Close()
+		responses <- resp
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- drainServer(ctx, ts.Config, 2*time.Second) }()
+
+	// New connections are refused while the request finishes
+	for !servingListener.Load().closed.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	if conn, err := net.Dial("tcp", ts.Listener.Addr().String()); err == nil {
+		conn.Close()
+		t.Error("new connection accepted during IDLE_DRAIN")
+	}
+
+	time.AfterFunc(100*time.Millisecond, func() { close(release) })
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("drain took %v, want it to end once the request finished", elapsed)
+	}
+	if resp := <-responses; resp != nil && !resp.Close {
+		t.Error("response during IDLE_DRAIN did not ask the client to close the connection")
+	}
+}
+
+func TestIdleDrainGivesUpAfterWindow(t *testing.T) {
+	setConfig(t, nil)
+	resetShutdownState(t)
+	captureLogs(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	ts := drainTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	go func() {
+		if resp, err := http.Get(ts.URL); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	start := time.Now()
+	waitForConnsToClose(context.Background(), ts.Config, 200*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("wait took %v, want about IDLE_DRAIN 200ms for a request still running", elapsed)
+	}
+}
+
+func TestIdleDrainDisabled(t *testing.T) {
+	setConfig(t, nil)
+	resetShutdownState(t)
+	captureLogs(t)
+	ts, _ := idleConnServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := drainServer(ctx, ts.Config, 0); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("drain took %v, want idle connections closed at once without IDLE_DRAIN", elapsed)
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// startupComplete opens the startup gate once the listener is up and
+// STARTUP_WARMUP has elapsed
+var startupComplete atomic.Bool
+
+// warmupStarted is when STARTUP_WARMUP began, for the Retry-After it leaves
+var warmupStarted atomic.Pointer[time.Time]
+
+// warmUp opens the startup gate after d; requests arriving before then get 503
+func warmUp(d time.Duration) {
+	if d <= 0 {
+		startupComplete.Store(true)
+		return
+	}
+
+	log.Printf("Warming up for %v before accepting traffic", d)
+	started := clock.Now()
+	warmupStarted.Store(&started)
+	time.AfterFunc(d, func() {
+		startupComplete.Store(true)
+		log.Printf("Warmup complete, accepting traffic")
+	})
+}
+
+// Interval between dependency probes while waiting at startup
+const startupProbeInterval = time.Second
+
+// waitForDependencies probes every dependency check until all pass or
+// timeout elapses, returning the failures still outstanding at the deadline
+func waitForDependencies(timeout time.Duration) error {
+	if timeout <= 0 || len(dependencyChecks) == 0 {
+		return nil
+	}
+
+	log.Printf("Waiting up to %v for %d dependencies", timeout, len(dependencyChecks))
+	deadline := clock.Now().Add(timeout)
+	for {
+		var failures []string
+		for _, hc := range dependencyChecks {
+			if result := runCheck(context.Background(), "startup", hc); result.Status != "ok" {
+				failures = append(failures, hc.Name+": "+result.Error)
+			}
+		}
+		if len(failures) == 0 {
+			log.Printf("All dependencies ready")
+			return nil
+		}
+		remaining := deadline.Sub(clock.Now())
+		if remaining <= 0 {
+			return fmt.Errorf("dependencies not ready after %v: %s", timeout, strings.Join(failures, "; "))
+		}
+		time.Sleep(min(startupProbeInterval, remaining))
+	}
+}
+
+// checkStartupDependencies waits for dependencies and returns an error only
+// when startup should abort; with STARTUP_FAIL_FAST off it logs and proceeds
+// degraded
+func checkStartupDependencies(c Config) error {
+	err := waitForDependencies(c.StartupProbeTimeout)
+	if err == nil || c.StartupFailFast {
+		return err
+	}
+	log.Printf("Warning: starting degraded, %v", err)
+	return nil
+}
+
+// startupGateMiddleware answers 503 with Retry-After until warmup completes.
+// Health and readiness probes bypass it.
+func startupGateMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if startupComplete.Load() || probePaths[r.URL.Path] {
+			next(w, r)
+			return
+		}
+
+		setRetryAfter(w, warmupRemaining())
+		writeLocalizedError(w, r, http.StatusServiceUnavailable, "starting_up")
+	}
+}
+
+// warmupRemaining is how much of STARTUP_WARMUP is left
+func warmupRemaining() time.Duration {
+	started := warmupStarted.Load()
+	if started == nil {
+		return cfg.StartupWarmup
+	}
+	return cfg.StartupWarmup - clock.Since(*started)
+}
+
+// Made with Bob
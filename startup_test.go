@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartupGateDuringWarmup(t *testing.T) {
+	setConfig(t, func(c *Config) {
+		c.StartupWarmup = 10 * time.Second
+		c.RetryAfterJitter = 0
+	})
+	setReadiness(t)
+	startupComplete.Store(false)
+	fake := newFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	setClock(t, fake)
+	started := fake.Now()
+	warmupStarted.Store(&started)
+	t.Cleanup(func() { warmupStarted.Store(nil) })
+
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/health", healthHandler)
+	router.Handle(http.MethodGet, "/readiness", readinessHandler)
+	router.Handle(http.MethodGet, "/api/info", okHandler)
+	handler := startupGateMiddleware(router.ServeHTTP)
+
+	rec := serve(handler, http.MethodGet, "/api/info", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("during warmup: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("during warmup: Retry-After = %q, want 10", got)
+	}
+	fake.Advance(6500 * time.Millisecond)
+	if got := serve(handler, http.MethodGet, "/api/info", "").Header().Get("Retry-After"); got != "4" {
+		t.Errorf("6.5s into warmup: Retry-After = %q, want the 4s left", got)
+	}
+	if rec := serve(handler, http.MethodGet, "/health", ""); rec.Code != http.StatusOK {
+		t.Errorf("health during warmup: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := serve(handler, http.MethodGet, "/readiness", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readiness during warmup: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	warmUp(0)
+	if rec := serve(handler, http.MethodGet, "/api/info", ""); rec.Code != http.StatusOK {
+		t.Errorf("after warmup: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+// setUnreachableDependency registers one dependency check against a server
+// that is no longer listening
+func setUnreachableDependency(t *testing.T) {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(okHandler))
+	url := ts.URL
+	ts.Close()
+
+	saved := dependencyChecks
+	dependencyChecks = []HealthCheck{{Name: url, Check: httpCheck(url)}}
+	t.Cleanup(func() { dependencyChecks = saved })
+}
+
+func TestStartupUnreachableDependencyFailFast(t *testing.T) {
+	captureLogs(t)
+	setUnreachableDependency(t)
+
+	start := time.Now()
+	err := checkStartupDependencies(Config{StartupProbeTimeout: 100 * time.Millisecond, StartupFailFast: true})
+	if err == nil {
+		t.Fatal("startup proceeded with an unreachable dependency")
+	}
+	if !strings.Contains(err.Error(), "not ready after 100ms") {
+		t.Errorf("error = %v, want the probe timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("waited %v, want about STARTUP_PROBE_TIMEOUT", elapsed)
+	}
+}
+
+func TestStartupUnreachableDependencyDegraded(t *testing.T) {
+	logs := captureLogs(t)
+	setUnreachableDependency(t)
+
+	if err := checkStartupDependencies(Config{StartupProbeTimeout: 100 * time.Millisecond, StartupFailFast: false}); err != nil {
+		t.Fatalf("startup aborted without STARTUP_FAIL_FAST: %v", err)
+	}
+	if !strings.Contains(logs.String(), "starting degraded") {
+		t.Errorf("degraded start not logged:\n%s", logs)
+	}
+}
+
+func TestStartupReachableDependency(t *testing.T) {
+	captureLogs(t)
+	ts := httptest.NewServer(http.HandlerFunc(okHandler))
+	defer ts.Close()
+	saved := dependencyChecks
+	dependencyChecks = []HealthCheck{{Name: ts.URL, Check: httpCheck(ts.URL)}}
+	t.Cleanup(func() { dependencyChecks = saved })
+
+	if err := checkStartupDependencies(Config{StartupProbeTimeout: time.Second, StartupFailFast: true}); err != nil {
+		t.Errorf("reachable dependency: %v", err)
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// Seconds between automatic reloads of the /status page
+const statusRefreshSeconds = 10
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>Go HTTP Server status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+.ok { color: #080; }
+.failing { color: #c00; }
+</style>
+</head>
+<body>
+<h1>Go HTTP Server <span class="{{.Summary.Status}}">{{.Summary.Status}}</span></h1>
+<table>
+<tr><th>Version</th><td>{{.Version}}</td></tr>
+<tr><th>Uptime</th><td>{{.Uptime}}</td></tr>
+<tr><th>Requests served</th><td>{{.Requests}}</td></tr>
+<tr><th>Goroutines</th><td>{{.Goroutines}}</td></tr>
+</table>
+<h2>Checks</h2>
+<table>
+<tr><th>Name</th><th>Kind</th><th>Status</th><th>Latency</th><th>Error</th></tr>
+{{range .Summary.Checks}}<tr><td>{{.Name}}</td><td>{{.Kind}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{.Latency}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+<p>Refreshes every {{.Refresh}}s. JSON: <a href="/health/summary">/health/summary</a></p>
+</body>
+</html>
+`))
+
+type statusPage struct {
+	Version    string
+	Uptime     string
+	Requests   int64
+	Goroutines int
+	Refresh    int
+	Summary    HealthSummaryResponse
+}
+
+// statusHandler renders the /health/summary data as an auto-refreshing HTML page
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	page := statusPage{
+		Version:    version,
+		Uptime:     uptime().Round(time.Second).String(),
+		Requests:   requestsServed.Load(),
+		Goroutines: runtime.NumGoroutine(),
+		Refresh:    statusRefreshSeconds,
+		Summary:    healthSummary(r.Context()),
+	}
+
+	var buf bytes.Buffer
+	if err := statusTemplate.Execute(&buf, page); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	if _, err := w.Write(buf.Bytes()); err != nil && !isClientDisconnect(err) {
+		slog.Error("Failed to write status page", "error", err)
+	}
+}
+
+// Made with Bob
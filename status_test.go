@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStatusPageRendersKeyFields(t *testing.T) {
+	setConfig(t, nil)
+	setMaintenance(t, false)
+	setReadiness(t, HealthCheck{Name: "database", Check: func(ctx context.Context) error {
+		return errors.New("connection <refused>")
+	}})
+
+	rec := serve(http.HandlerFunc(statusHandler), http.MethodGet, "/status", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want HTML", got)
+	}
+
+	page := rec.Body.String()
+	for _, want := range []string{
+		"<td>" + version + "</td>",
+		"Uptime",
+		"Requests served",
+		"Goroutines",
+		`content="` + strconv.Itoa(statusRefreshSeconds) + `"`,
+		"<td>database</td>",
+		`<td class="failing">failing</td>`,
+		"connection &lt;refused&gt;",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page is missing %q:\n%s", want, page)
+		}
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sync"
+)
+
+// Content-Type selecting RFC 7386 JSON Merge Patch semantics for PATCH
+const mergePatchContentType = "application/merge-patch+json"
+
+// DataStore is an in-memory, concurrency-safe store of data records keyed by name
+type DataStore struct {
+	mu      sync.RWMutex
+	records map[string]DataRequest
+}
+
+func NewDataStore() *DataStore {
+	return &DataStore{records: make(map[string]DataRequest)}
+}
+
+var dataStore = NewDataStore()
+
+func (s *DataStore) Get(name string) (DataRequest, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[name]
+	return rec, ok
+}
+
+func (s *DataStore) Put(rec DataRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[rec.Name] = rec
+}
+
+// Delete removes a record, reporting whether it existed
+func (s *DataStore) Delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.records[name]
+	delete(s.records, name)
+	return ok
+}
+
+// Update applies fn to an existing record under the write lock.
+// It returns false if no record with that name exists.
+func (s *DataStore) Update(name string, fn func(*DataRequest)) (DataRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[name]
+	if !ok {
+		return DataRequest{}, false
+	}
+	fn(&rec)
+	s.records[name] = rec
+	return rec, true
+}
+
+// DataPatchRequest uses pointer fields so omitted fields can be told apart from empty ones
+type DataPatchRequest struct {
+	Name  *string `json:"name"`
+	Value *string `json:"value"`
+}
+
+func getDataHandler(r *http.Request) (int, interface{}, error) {
+	rec, ok := dataStore.Get(pathParam(r, "name"))
+	if !ok {
+		return 0, nil, apiError(http.StatusNotFound, "record_not_found")
+	}
+
+	return http.StatusOK, DataResponse{
+		Success:   true,
+		Data:      rec,
+		Timestamp: nowFunc(),
+	}, nil
+}
+
+func putDataHandler(r *http.Request) (int, interface{}, error) {
+	name := pathParam(r, "name")
+
+	var req DataRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		if requestCancelled(r) {
+			return 0, nil, errRequestCancelled
+		}
+		return 0, nil, apiError(http.StatusBadRequest, "invalid_json")
+	}
+	if req.Name != "" && req.Name != name {
+		return 0, nil, apiError(http.StatusBadRequest, "record_name_immutable")
+	}
+	req.Name = name
+
+	dataStore.Put(req)
+
+	return http.StatusOK, DataResponse{
+		Success:   true,
+		Data:      req,
+		Timestamp: nowFunc(),
+	}, nil
+}
+
+// patchDataHandler applies a JSON Merge Patch when sent as
+// application/merge-patch+json, and a plain partial update otherwise
+func patchDataHandler(r *http.Request) (int, interface{}, error) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == mergePatchContentType {
+		return mergePatchDataHandler(r)
+	}
+
+	name := pathParam(r, "name")
+
+	var req DataPatchRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		if requestCancelled(r) {
+			return 0, nil, errRequestCancelled
+		}
+		return 0, nil, apiError(http.StatusBadRequest, "invalid_json")
+	}
+	if req.Name != nil && *req.Name != name {
+		return 0, nil, apiError(http.StatusBadRequest, "record_name_immutable")
+	}
+
+	rec, ok := dataStore.Update(name, func(rec *DataRequest) {
+		if req.Value != nil {
+			rec.Value = *req.Value
+		}
+	})
+	if !ok {
+		return 0, nil, apiError(http.StatusNotFound, "record_not_found")
+	}
+
+	return http.StatusOK, DataResponse{
+		Success:   true,
+		Data:      rec,
+		Timestamp: nowFunc(),
+	}, nil
+}
+
+func mergePatchDataHandler(r *http.Request) (int, interface{}, error) {
+	name := pathParam(r, "name")
+
+	var patch map[string]interface{}
+	if err := decodeJSONBody(r, &patch); err != nil || patch == nil {
+		if requestCancelled(r) {
+			return 0, nil, errRequestCancelled
+		}
+		return 0, nil, apiError(http.StatusBadRequest, "invalid_json")
+	}
+
+	var patchErr error
+	rec, ok := dataStore.Update(name, func(rec *DataRequest) {
+		patched, err := applyMergePatch(*rec, patch)
+		if err != nil {
+			patchErr = err
+			return
+		}
+		*rec = patched
+	})
+	if !ok {
+		return 0, nil, apiError(http.StatusNotFound, "record_not_found")
+	}
+	if patchErr != nil {
+		return 0, nil, patchErr
+	}
+
+	return http.StatusOK, DataResponse{
+		Success:   true,
+		Data:      rec,
+		Timestamp: nowFunc(),
+	}, nil
+}
+
+// applyMergePatch merges patch into rec's JSON form. A null member resets
+// that field; the name cannot be changed or removed.
+func applyMergePatch(rec DataRequest, patch map[string]interface{}) (DataRequest, error) {
+	doc, err := json.Marshal(rec)
+	if err != nil {
+		return rec, err
+	}
+	var target map[string]interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return rec, err
+	}
+
+	merged := mergePatch(target, patch).(map[string]interface{})
+	if merged["name"] != rec.Name {
+		return rec, apiError(http.StatusBadRequest, "record_name_immutable")
+	}
+
+	doc, err = json.Marshal(merged)
+	if err != nil {
+		return rec, err
+	}
+	var patched DataRequest
+	if err := json.Unmarshal(doc, &patched); err != nil {
+		return rec, apiError(http.StatusBadRequest, "invalid_json")
+	}
+	return patched, nil
+}
+
+// mergePatch applies an RFC 7386 merge patch to target: null members are
+// removed, objects merge recursively and any other value replaces
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergePatch(targetObj[key], value)
+	}
+	return targetObj
+}
+
+// deleteDataHandler is idempotent: deleting a missing record also succeeds
+// unless STRICT_DELETE is set
+func deleteDataHandler(r *http.Request) (int, interface{}, error) {
+	if !dataStore.Delete(pathParam(r, "name")) && cfg.StrictDelete {
+		return 0, nil, apiError(http.StatusNotFound, "record_not_found")
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+// Made with Bob
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeData(t *testing.T, body []byte) DataRequest {
+	t.Helper()
+	var resp DataResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	return resp.Data
+}
+
+func TestPatchDataUpdatesProvidedFields(t *testing.T) {
+	setConfig(t, nil)
+	router := newAPIRouter(t)
+	dataStore.Put(DataRequest{Name: "item", Value: "old"})
+
+	rec := serve(router, http.MethodPatch, "/api/data/item", `{"value":"new"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if got := decodeData(t, rec.Body.Bytes()); got != (DataRequest{Name: "item", Value: "new"}) {
+		t.Errorf("response data = %+v", got)
+	}
+	if got, _ := dataStore.Get("item"); got.Value != "new" {
+		t.Errorf("stored value = %q, want %q", got.Value, "new")
+	}
+}
+
+func TestPatchDataKeepsOmittedFields(t *testing.T) {
+	setConfig(t, nil)
+	router := newAPIRouter(t)
+	dataStore.Put(DataRequest{Name: "item", Value: "kept"})
+
+	rec := serve(router, http.MethodPatch, "/api/data/item", `{}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if got, _ := dataStore.Get("item"); got.Value != "kept" {
+		t.Errorf("stored value = %q, want it unchanged", got.Value)
+	}
+}
+
+func TestPatchDataNotFound(t *testing.T) {
+	setConfig(t, nil)
+	router := newAPIRouter(t)
+
+	rec := serve(router, http.MethodPatch, "/api/data/missing", `{"value":"x"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if _, ok := dataStore.Get("missing"); ok {
+		t.Error("PATCH created a missing record")
+	}
+}
+
+func TestPatchDataRejectsRename(t *testing.T) {
+	setConfig(t, nil)
+	router := newAPIRouter(t)
+	dataStore.Put(DataRequest{Name: "item", Value: "v"})
+
+	rec := serve(router, http.MethodPatch, "/api/data/item", `{"name":"other"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func serveMergePatch(h http.Handler, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMergePatchSetsField(t *testing.T) {
+	setConfig(t, nil)
+	router := newAPIRouter(t)
+	dataStore.Put(DataRequest{Name: "item", Value: "old"})
+
+	rec := serveMergePatch(router, "/api/data/item", `{"value":"new"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if got, _ := dataStore.Get("item"); got != (DataRequest{Name: "item", Value: "new"}) {
+		t.Errorf("stored = %+v", got)
+	}
+}
+
+func TestMergePatchNullDeletesField(t *testing.T) {
+	setConfig(t, nil)
+	router := newAPIRouter(t)
+	dataStore.Put(DataRequest{Name: "item", Value: "gone"})
+
+	rec := serveMergePatch(router, "/api/data/item", `{"value":null}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if got := decodeData(t, rec.Body.Bytes()); got != (DataRequest{Name: "item"}) {
+		t.Errorf("response data = %+v, want the value cleared", got)
+	}
+
+	// A plain PATCH treats null as "leave unchanged"
+	dataStore.Put(DataRequest{Name: "item", Value: "kept"})
+	serve(router, http.MethodPatch, "/api/data/item", `{"value":null}`)
+	if got, _ := dataStore.Get("item"); got.Value != "kept" {
+		t.Errorf("plain PATCH with null: value = %q, want it unchanged", got.Value)
+	}
+}
+
+func TestMergePatchNotFound(t *testing.T) {
+	setConfig(t, nil)
+	router := newAPIRouter(t)
+
+	if rec := serveMergePatch(router, "/api/data/missing", `{"value":"x"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestMergePatchRejectsNameChanges(t *testing.T) {
+	setConfig(t, nil)
+	router := newAPIRouter(t)
+	dataStore.Put(DataRequest{Name: "item", Value: "v"})
+
+	for _, body := range []string{`{"name":"other"}`, `{"name":null}`, `[1]`} {
+		if rec := serveMergePatch(router, "/api/data/item", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+	if got, _ := dataStore.Get("item"); got != (DataRequest{Name: "item", Value: "v"}) {
+		t.Errorf("stored = %+v, want it unchanged", got)
+	}
+}
+
+func TestMergePatchRFC7386(t *testing.T) {
+	target := map[string]interface{}{
+		"a": "b",
+		"c": map[string]interface{}{"d": "e", "f": "g"},
+	}
+	patch := map[string]interface{}{
+		"a": "z",
+		"c": map[string]interface{}{"f": nil},
+	}
+	want := map[string]interface{}{
+		"a": "z",
+		"c": map[string]interface{}{"d": "e"},
+	}
+	if got := mergePatch(target, patch); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergePatch = %v, want %v", got, want)
+	}
+}
+
+func TestDeleteDataIsIdempotent(t *testing.T) {
+	setConfig(t, nil)
+	router := newAPIRouter(t)
+	dataStore.Put(DataRequest{Name: "item", Value: "gone soon"})
+
+	for i := 0; i < 2; i++ {
+		rec := serve(router, http.MethodDelete, "/api/data/item", "")
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("delete %d: status = %d, want %d", i+1, rec.Code, http.StatusNoContent)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("delete %d: body = %q, want none", i+1, rec.Body)
+		}
+	}
+	if _, ok := dataStore.Get("item"); ok {
+		t.Error("record still stored after DELETE")
+	}
+}
+
+func TestStrictDeleteReportsMissing(t *testing.T) {
+	setConfig(t, func(c *Config) { c.StrictDelete = true })
+	router := newAPIRouter(t)
+	dataStore.Put(DataRequest{Name: "item", Value: "gone soon"})
+
+	if rec := serve(router, http.MethodDelete, "/api/data/item", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("first delete: status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := serve(router, http.MethodDelete, "/api/data/item", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("re-delete: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeoutMiddleware bounds a handler to d. A handler still running at the
+// deadline has its request context cancelled and the client gets a
+// TIMEOUT_STATUS request_timeout error instead of its output.
+//
+// It works like http.TimeoutHandler, buffering the handler's response until
+// it finishes, but its writer starts from the response headers set so far
+// and unwraps to the outer writer, so findWriter lookups (?pretty, ?fields,
+// uncompressed, the metrics route) and the request ID keep working.
+func timeoutMiddleware(d time.Duration) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{ResponseWriter: w, header: w.Header().Clone(), status: http.StatusOK}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				dst := w.Header()
+				for name := range dst {
+					delete(dst, name)
+				}
+				for name, values := range tw.header {
+					dst[name] = values
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.err = ctx.Err()
+				if errors.Is(tw.err, context.DeadlineExceeded) {
+					slog.Warn("Handler timed out", "method", r.Method, "path", r.URL.Path, "timeout", d)
+					writeLocalizedError(w, r, cfg.TimeoutStatus, "request_timeout", d)
+				}
+			}
+		}
+	}
+}
+
+// errFlushBuffered stops http.ResponseController from flushing past a
+// timeoutWriter, which would send headers before the handler has finished
+var errFlushBuffered = errors.New("response is buffered until the handler finishes")
+
+// timeoutWriter buffers a handler's response for timeoutMiddleware
+type timeoutWriter struct {
+	http.ResponseWriter
+
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	status      int
+	wroteHeader bool
+	err         error
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil || w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.wroteHeader = true
+	return w.buf.Write(b)
+}
+
+func (w *timeoutWriter) FlushError() error {
+	return errFlushBuffered
+}
+
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// parseRouteTimeouts reads ROUTE_TIMEOUTS entries such as
+// "POST /api/echo/raw=30s", keyed by method and unversioned pattern,
+// warning about malformed entries
+func parseRouteTimeouts(entries []string) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range entries {
+		key, value, ok := strings.Cut(entry, "=")
+		method, pattern, _ := strings.Cut(strings.TrimSpace(key), " ")
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		pattern = strings.TrimSpace(pattern)
+		if !ok || method == "" || !strings.HasPrefix(pattern, "/") || err != nil || d <= 0 {
+			log.Printf("Warning: skipping malformed ROUTE_TIMEOUTS entry %q", entry)
+			continue
+		}
+		timeouts[strings.ToUpper(method)+" "+pattern] = d
+	}
+	return timeouts
+}
+
+// Made with Bob
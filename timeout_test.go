@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutAnswersRequestTimeout(t *testing.T) {
+	for _, status := range []int{http.StatusGatewayTimeout, http.StatusServiceUnavailable} {
+		setConfig(t, func(c *Config) { c.TimeoutStatus = status })
+		logs := captureLogs(t)
+
+		rec := serve(timeoutMiddleware(20*time.Millisecond)(sleepHandler(time.Second)), http.MethodGet, "/slow", "")
+		if rec.Code != status {
+			t.Errorf("status = %d, want TIMEOUT_STATUS %d", rec.Code, status)
+		}
+		var resp ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("body is not an ErrorResponse: %v: %s", err, rec.Body)
+		}
+		if resp.Code != "request_timeout" {
+			t.Errorf("code = %q, want request_timeout", resp.Code)
+		}
+		if !strings.Contains(logs.String(), "Handler timed out") {
+			t.Errorf("timeout not logged:\n%s", logs)
+		}
+	}
+}
+
+func TestTimeoutClientCancelWritesNothing(t *testing.T) {
+	setConfig(t, nil)
+	logs := captureLogs(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx)
+	time.AfterFunc(20*time.Millisecond, cancel)
+	rec := httptest.NewRecorder()
+	timeoutMiddleware(time.Second)(sleepHandler(5*time.Second))(rec, req)
+
+	if rec.Body.Len() != 0 || rec.Code != http.StatusOK {
+		t.Errorf("response to a cancelled client: %d %s, want nothing written", rec.Code, rec.Body)
+	}
+	if strings.Contains(logs.String(), "Handler timed out") {
+		t.Errorf("client cancel logged as a timeout:\n%s", logs)
+	}
+}
+
+func TestRequestCancelledLogsCause(t *testing.T) {
+	logs := captureLogs(t)
+
+	timedOut, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if !requestCancelled(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(timedOut)) {
+		t.Error("timed-out request not reported as cancelled")
+	}
+	if !strings.Contains(logs.String(), "Request abandoned after handler timeout") {
+		t.Errorf("timeout not logged as such:\n%s", logs)
+	}
+
+	gone, cancel := context.WithCancel(context.Background())
+	cancel()
+	if !requestCancelled(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(gone)) {
+		t.Error("client-cancelled request not reported as cancelled")
+	}
+	if !strings.Contains(logs.String(), "Request cancelled by client") {
+		t.Errorf("client cancel not logged as such:\n%s", logs)
+	}
+}
+
+// Made with Bob
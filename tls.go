@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const clientIdentityKey contextKey = "clientIdentity"
+
+// tlsVersions maps TLS_MIN_VERSION values to crypto/tls constants
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// buildTLSConfig turns the TLS_* settings into a tls.Config. Only cipher
+// suites Go considers secure may be selected; they apply to TLS 1.2 and
+// below, as TLS 1.3 suites are not configurable.
+func buildTLSConfig(c Config) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(c.TLSMinVersion), "tls")]
+	if !ok {
+		return nil, fmt.Errorf("invalid TLS_MIN_VERSION %q: use 1.0, 1.1, 1.2 or 1.3", c.TLSMinVersion)
+	}
+
+	tlsCfg := &tls.Config{MinVersion: minVersion}
+
+	if len(c.TLSCipherSuites) > 0 {
+		available := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			available[suite.Name] = suite.ID
+		}
+		for _, name := range c.TLSCipherSuites {
+			id, ok := available[name]
+			if !ok {
+				return nil, fmt.Errorf("invalid TLS_CIPHER_SUITES entry %q: not a supported secure cipher suite", name)
+			}
+			tlsCfg.CipherSuites = append(tlsCfg.CipherSuites, id)
+		}
+	}
+
+	if c.TLSClientCA != "" {
+		pem, err := os.ReadFile(c.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read TLS_CLIENT_CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TLS_CLIENT_CA %s contains no PEM certificates", c.TLSClientCA)
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsCfg, nil
+}
+
+// ClientIdentity describes the verified client certificate of an mTLS request
+type ClientIdentity struct {
+	CommonName string   `json:"common_name"`
+	DNSNames   []string `json:"dns_names,omitempty"`
+	URIs       []string `json:"uris,omitempty"`
+}
+
+// String names the client by CN, falling back to its first SAN
+func (id ClientIdentity) String() string {
+	switch {
+	case id.CommonName != "":
+		return id.CommonName
+	case len(id.DNSNames) > 0:
+		return id.DNSNames[0]
+	case len(id.URIs) > 0:
+		return id.URIs[0]
+	}
+	return ""
+}
+
+// clientIdentityMiddleware stores the verified client certificate's identity
+// in the request context; requests without one pass through unchanged
+func clientIdentityMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			next(w, r)
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		id := ClientIdentity{
+			CommonName: cert.Subject.CommonName,
+			DNSNames:   cert.DNSNames,
+		}
+		for _, u := range cert.URIs {
+			id.URIs = append(id.URIs, u.String())
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), clientIdentityKey, id)))
+	}
+}
+
+// clientIdentityFromContext returns the verified mTLS client identity, if any
+func clientIdentityFromContext(ctx context.Context) (ClientIdentity, bool) {
+	id, ok := ctx.Value(clientIdentityKey).(ClientIdentity)
+	return id, ok
+}
+
+// Made with Bob
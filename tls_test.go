@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildTLSConfigFromEnv(t *testing.T) {
+	t.Setenv("TLS_MIN_VERSION", "TLS1.3")
+	t.Setenv("TLS_CIPHER_SUITES", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384")
+
+	tlsCfg, err := buildTLSConfig(LoadConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsCfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion = %x, want TLS 1.3", tlsCfg.MinVersion)
+	}
+	want := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}
+	if len(tlsCfg.CipherSuites) != len(want) || tlsCfg.CipherSuites[0] != want[0] || tlsCfg.CipherSuites[1] != want[1] {
+		t.Errorf("CipherSuites = %x, want %x", tlsCfg.CipherSuites, want)
+	}
+	if tlsCfg.ClientAuth != tls.NoClientCert {
+		t.Errorf("ClientAuth = %v without TLS_CLIENT_CA", tlsCfg.ClientAuth)
+	}
+}
+
+func TestBuildTLSConfigDefaults(t *testing.T) {
+	t.Setenv("TLS_MIN_VERSION", "")
+	t.Setenv("TLS_CIPHER_SUITES", "")
+
+	tlsCfg, err := buildTLSConfig(LoadConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsCfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %x, want TLS 1.2", tlsCfg.MinVersion)
+	}
+	if tlsCfg.CipherSuites != nil {
+		t.Errorf("CipherSuites = %x, want Go's defaults", tlsCfg.CipherSuites)
+	}
+}
+
+func TestBuildTLSConfigRejectsInvalidValues(t *testing.T) {
+	tests := map[string]Config{
+		"unknown version":   {TLSMinVersion: "1.4"},
+		"unknown suite":     {TLSMinVersion: "1.2", TLSCipherSuites: []string{"TLS_MADE_UP"}},
+		"insecure suite":    {TLSMinVersion: "1.2", TLSCipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		"missing client CA": {TLSMinVersion: "1.2", TLSClientCA: "/nonexistent/ca.pem"},
+	}
+	for name, c := range tests {
+		if _, err := buildTLSConfig(c); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+// testCA is a throwaway certificate authority for mTLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// clientCert issues a client certificate for cn signed by ca
+func (ca *testCA) clientCert(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn + ".internal"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestMutualTLS(t *testing.T) {
+	trusted, untrusted := newTestCA(t), newTestCA(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, trusted.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tlsCfg, err := buildTLSConfig(Config{TLSMinVersion: "1.2", TLSClientCA: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(clientIdentityMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := clientIdentityFromContext(r.Context())
+		fmt.Fprint(w, id)
+	}))
+	srv.TLS = tlsCfg
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	clientWith := func(certs ...tls.Certificate) *http.Client {
+		transport := srv.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		return &http.Client{Transport: transport}
+	}
+
+	resp, err := clientWith(trusted.clientCert(t, "billing")).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("trusted client cert rejected: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "billing" {
+		t.Errorf("client identity = %q, want billing", body)
+	}
+
+	if _, err := clientWith(untrusted.clientCert(t, "intruder")).Get(srv.URL); err == nil {
+		t.Error("client cert from an untrusted CA accepted")
+	}
+	if _, err := clientWith().Get(srv.URL); err == nil {
+		t.Error("connection without a client cert accepted")
+	}
+}
+
+// Made with Bob
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span records a single server-side request for export over OTLP/HTTP
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Start        time.Time
+	End          time.Time
+	StatusCode   int
+	Attributes   map[string]string
+}
+
+// SpanExporter receives finished spans
+type SpanExporter interface {
+	Export(span *Span)
+	Shutdown(ctx context.Context) error
+}
+
+var spanExporter SpanExporter
+
+// tracingMiddleware starts a span per request, continuing any incoming
+// W3C traceparent. When tracing is disabled it returns next unchanged.
+func tracingMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	if spanExporter == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		span := &Span{
+			SpanID: newSpanID(),
+			Start:  clock.Now(),
+			Attributes: map[string]string{
+				"http.method": r.Method,
+				"http.target": r.URL.Path,
+			},
+		}
+		if traceID, parentID, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			span.TraceID, span.ParentSpanID = traceID, parentID
+		} else {
+			span.TraceID = newTraceID()
+		}
+
+		r, route := captureRoute(r)
+		rec := newStatusRecorder(w)
+		next(rec, r)
+
+		span.End = clock.Now()
+		span.StatusCode = rec.status
+		span.Name = r.Method + " " + *route
+		if *route == "" {
+			span.Name = r.Method
+		} else {
+			span.Attributes["http.route"] = *route
+		}
+		spanExporter.Export(span)
+	}
+}
+
+// parseTraceparent extracts the trace and parent span IDs from a
+// version-00 traceparent header
+func parseTraceparent(header string) (traceID, parentID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", "", false
+	}
+	if !isHex(parts[1]) || !isHex(parts[2]) || !isHex(parts[3]) {
+		return "", "", false
+	}
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+func newTraceID() string { return randomHex(16) }
+func newSpanID() string  { return randomHex(8) }
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// otlpExporter batches spans and posts them to an OTLP/HTTP collector as JSON
+type otlpExporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+	spans       chan *Span
+	done        chan struct{}
+
+	// mu guards closing spans, so a late Export cannot send on it
+	mu     sync.Mutex
+	closed bool
+}
+
+const (
+	otlpBatchSize     = 100
+	otlpFlushInterval = 5 * time.Second
+)
+
+func newOTLPExporter(endpoint, serviceName string) *otlpExporter {
+	e := &otlpExporter{
+		url:         strings.TrimRight(endpoint, "/") + "/v1/traces",
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		spans:       make(chan *Span, 1024),
+		done:        make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Export queues a span, dropping it if the queue is full or the exporter
+// has shut down, as it may for a request outliving the shutdown timeout
+func (e *otlpExporter) Export(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		slog.Debug("Span exporter shut down, dropping span", "name", span.Name)
+		return
+	}
+	select {
+	case e.spans <- span:
+	default:
+		slog.Debug("Span queue full, dropping span", "name", span.Name)
+	}
+}
+
+// Shutdown flushes queued spans and stops the exporter
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.spans)
+	}
+	e.mu.Unlock()
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *otlpExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case span, ok := <-e.spans:
+			if !ok {
+				e.send(batch)
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				e.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = nil
+		}
+	}
+}
+
+func (e *otlpExporter) send(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(e.payload(batch))
+	if err != nil {
+		slog.Error("Failed to encode spans", "error", err)
+		return
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("Failed to export spans", "error", err, "count", len(batch))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Warn("Collector rejected spans", "status", resp.StatusCode, "count", len(batch))
+	}
+}
+
+// OTLP JSON encoding, see opentelemetry-proto's trace.proto
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+	Status            struct {
+		Code int `json:"code"`
+	} `json:"status"`
+}
+
+const (
+	otlpSpanKindServer  = 2
+	otlpStatusCodeError = 2
+)
+
+func (e *otlpExporter) payload(batch []*Span) interface{} {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		out := otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			Name:              s.Name,
+			Kind:              otlpSpanKindServer,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+		}
+		out.Attributes = append(out.Attributes, otlpAttributes(map[string]string{
+			"http.status_code": strconv.Itoa(s.StatusCode),
+		})...)
+		if s.StatusCode >= http.StatusInternalServerError {
+			out.Status.Code = otlpStatusCodeError
+		}
+		spans = append(spans, out)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]string{"service.name": e.serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": e.serviceName},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttributes(attrs map[string]string) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		kv := otlpKeyValue{Key: k}
+		kv.Value.StringValue = v
+		kvs = append(kvs, kv)
+	}
+	return kvs
+}
+
+// Made with Bob
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// recordingExporter keeps exported spans for inspection
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *recordingExporter) Export(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *recordingExporter) Shutdown(ctx context.Context) error { return nil }
+
+func setSpanExporter(t *testing.T, exporter SpanExporter) {
+	t.Helper()
+	saved := spanExporter
+	spanExporter = exporter
+	t.Cleanup(func() { spanExporter = saved })
+}
+
+func TestTracingCreatesSpanWhenEnabled(t *testing.T) {
+	setConfig(t, nil)
+	exporter := &recordingExporter{}
+	setSpanExporter(t, exporter)
+
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	handler := tracingMiddleware(router.ServeHTTP)
+
+	req := newRequestWithHeader(http.MethodGet, "/items/7", "traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(exporter.spans) != 1 {
+		t.Fatalf("exported %d spans, want 1", len(exporter.spans))
+	}
+	span := exporter.spans[0]
+	if span.Name != "GET /items/{id}" || span.StatusCode != http.StatusAccepted {
+		t.Errorf("span = %q status %d", span.Name, span.StatusCode)
+	}
+	if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("span did not continue the incoming trace: trace %s parent %s", span.TraceID, span.ParentSpanID)
+	}
+	if span.Attributes["http.route"] != "/items/{id}" {
+		t.Errorf("http.route = %q", span.Attributes["http.route"])
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	setSpanExporter(t, nil)
+	called := false
+	next := func(w http.ResponseWriter, r *http.Request) { called = true }
+
+	tracingMiddleware(next)(httptest.NewRecorder(), newRequestWithHeader(http.MethodGet, "/", "", ""))
+	if !called {
+		t.Error("handler was not called with tracing disabled")
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		header string
+		ok     bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"garbage", false},
+	}
+	for _, tt := range tests {
+		if _, _, ok := parseTraceparent(tt.header); ok != tt.ok {
+			t.Errorf("parseTraceparent(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+		}
+	}
+}
+
+func TestOTLPExportAfterShutdown(t *testing.T) {
+	var received sync.WaitGroup
+	received.Add(1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Done()
+	}))
+	defer collector.Close()
+
+	exporter := newOTLPExporter(collector.URL, "test")
+	exporter.Export(&Span{Name: "before"})
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	received.Wait()
+
+	// A request still running after shutdown must not panic the server
+	exporter.Export(&Span{Name: "late"})
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Errorf("second Shutdown = %v", err)
+	}
+}
+
+// Made with Bob